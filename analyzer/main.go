@@ -43,13 +43,31 @@ func main() {
 				continue
 			}
 			sol = *inst.Solution
+			if sol.Infeasible {
+				fmt.Printf("%s,%t,%s,,,,%d,%s\n", inst.Name, sol.Optimal, sol.Time, inst.NodeCount, sol.Comment)
+				continue
+			}
 			inst.EdgeWeights = mtsp.CalcEdgeDist(inst.NodeCoordinates,inst.EdgeWeightType)
-			solValid, validComment := mtsp.CheckSolutionValidity(sol.Routes,inst.EdgeWeights,inst.TravelSpeeds,sol.Obj)
+			cMaxBound := sol.Obj
+			if sol.Objective == mtsp.OBJ_PRIZE {
+				cMaxBound = inst.TMax
+			} else if sol.Objective != "" && sol.Objective != mtsp.OBJ_MAKESPAN {
+				cMaxBound = sol.Makespan
+			}
+			solValid, validComment := mtsp.CheckSolutionValidity(&inst,sol.Routes,inst.EdgeWeights,cMaxBound)
 			if !solValid {
 				sol.Comment += fmt.Sprintf("%s %s",sol.Comment,validComment)
 			}
-			gap := math.Round((float64(sol.Obj-sol.LBound) / float64(sol.LBound)) * 1000) / 1000.0
-			fmt.Printf("%s,%t,%s,%d,%d,%.4f,%d,%s\n", inst.Name, sol.Optimal, sol.Time, sol.Obj, sol.LBound, gap, inst.NodeCount, sol.Comment)
+			diff, base := sol.Obj-sol.LBound, sol.LBound
+			if sol.Objective == mtsp.OBJ_PRIZE {
+				diff, base = sol.UBound-sol.Obj, sol.Obj
+			}
+			//the gap is left empty, if it is relative to 0
+			gap := ""
+			if base != 0 {
+				gap = fmt.Sprintf("%.4f", math.Round((float64(diff) / float64(base)) * 1000) / 1000.0)
+			}
+			fmt.Printf("%s,%t,%s,%d,%d,%s,%d,%s\n", inst.Name, sol.Optimal, sol.Time, sol.Obj, sol.LBound, gap, inst.NodeCount, sol.Comment)
 		}
 	}
 
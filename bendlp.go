@@ -0,0 +1,131 @@
+package mtsp
+
+import (
+	"fmt"
+	"math"
+
+	"git.solver4all.com/azaryc2s/gorobi/gurobi"
+)
+
+/* Benders optimality cuts from the duals of the 2-matching LP relaxation of the vehicle's TSP (BEND_LP). Valid for any distances, not for open routes. */
+
+//lpRhsTerm is the term factor*x_node in the right hand side of a constraint of the LP subproblem
+type lpRhsTerm struct {
+	node   int
+	factor float64
+}
+
+//lpCutCoefficients solves the LP subproblem of vehicle i for the assignment x and returns the coefficient of each X_ij in the cut
+func (model *MTSPModel) lpCutCoefficients(i int, x []float64) ([]float64, error) {
+	N := model.N
+	edges := make([][2]int, 0, N*(N-1)/2)
+	objFun := make([]float64, 0, N*(N-1)/2)
+	varNames := make([]string, 0, N*(N-1)/2)
+	for j := 0; j < N; j++ {
+		for k := j + 1; k < N; k++ {
+			edges = append(edges, [2]int{j, k})
+			objFun = append(objFun, float64(model.EdgeWeights[j][k]*model.TravelSpeeds[i]))
+			varNames = append(varNames, fmt.Sprintf("Y_%d_%d", j, k))
+		}
+	}
+	varType := make([]int8, len(edges))
+	for e := 0; e < len(edges); e++ {
+		varType[e] = gurobi.CONTINUOUS
+	}
+	lp, err := model.GEnv.NewModel("bend_lp", int32(len(edges)), objFun, nil, nil, varType, varNames)
+	if err != nil {
+		return nil, err
+	}
+	defer lp.Free()
+	err = lp.SetIntParam("OutputFlag", 0)
+	if err != nil {
+		return nil, err
+	}
+	terms := make([]lpRhsTerm, 0, N+2*len(edges))
+
+	//Add the degree constraints sum_{e in delta(j)} y_e = 2*x_j
+	for j := 0; j < N; j++ {
+		ind := make([]int32, 0, N-1)
+		val := make([]float64, 0, N-1)
+		for e := 0; e < len(edges); e++ {
+			if edges[e][0] == j || edges[e][1] == j {
+				ind = append(ind, int32(e))
+				val = append(val, 1.0)
+			}
+		}
+		err = lp.AddConstr(ind, val, gurobi.EQUAL, 2*x[j], fmt.Sprintf("DEG_%d", j))
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, lpRhsTerm{j, 2.0})
+	}
+	//Add the linking constraints y_jk <= x_j and y_jk <= x_k, a depot edge may be driven twice: y_0k <= 2*x_k
+	for e := 0; e < len(edges); e++ {
+		j, k := edges[e][0], edges[e][1]
+		if j == 0 {
+			err = lp.AddConstr([]int32{int32(e)}, []float64{1.0}, gurobi.LESS_EQUAL, 2*x[k], fmt.Sprintf("LINK_%d_%d", j, k))
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, lpRhsTerm{k, 2.0})
+			continue
+		}
+		for _, l := range []int{j, k} {
+			err = lp.AddConstr([]int32{int32(e)}, []float64{1.0}, gurobi.LESS_EQUAL, x[l], fmt.Sprintf("LINK_%d_%d_%d", j, k, l))
+			if err != nil {
+				return nil, err
+			}
+			terms = append(terms, lpRhsTerm{l, 1.0})
+		}
+	}
+
+	err = lp.Optimize()
+	if err != nil {
+		return nil, err
+	}
+	status, err := lp.GetIntAttr(gurobi.INT_ATTR_STATUS)
+	if err != nil {
+		return nil, err
+	}
+	if status != gurobi.OPTIMAL {
+		return nil, fmt.Errorf("the LP subproblem of vehicle %d ended with status %d", i, status)
+	}
+	pi, err := lp.GetDblAttrArray(spAttrPi, 0, int32(len(terms)))
+	if err != nil {
+		return nil, err
+	}
+	coef := make([]float64, N)
+	for c := 0; c < len(terms); c++ {
+		coef[terms[c].node] += pi[c] * terms[c].factor
+	}
+	for j := 0; j < N; j++ {
+		//the service times do not depend on the sequence
+		coef[j] += float64(model.ServiceTimes[i][j])
+	}
+	return coef, nil
+}
+
+//R_i >= sum_j coef_j*X_ij with the coefficients of lpCutCoefficients (or Cmax instead of R_i)
+func getBendersCutLP(model *MTSPModel, i int, coef []float64) (ind []int32, val []float64, op int8, rhs float64) {
+	for j := 0; j < model.N; j++ {
+		if math.Abs(coef[j]) < 1e-9 {
+			continue
+		}
+		ind = append(ind, int32(GetNodeIndex(i, j, model.N, model.XStart)))
+		val = append(val, -coef[j])
+	}
+	ind = append(ind, int32(model.routeVar(i)))
+	val = append(val, 1.0)
+	model.CutsBendersCount++
+	Log(3, "Adding LP dual Benders cut nr.%d for vehicle %d", model.CutsBendersCount, i)
+	return ind, val, gurobi.GREATER_EQUAL, 0.0
+}
+
+//isCutViolated reports whether the solution violates the cut sum(val*x) >= rhs
+func isCutViolated(sol []float64, ind []int32, val []float64, rhs float64) bool {
+	lhs := 0.0
+	for k := 0; k < len(ind); k++ {
+		lhs += val[k] * sol[ind[k]]
+	}
+	return lhs < rhs-1e-6
+}
@@ -0,0 +1,348 @@
+package mtsp
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+/* Cluster-first route-second heuristic for very large instances: capacitated k-medoids with shares proportional to the speeds,
+nearest neighbour and 2-opt per cluster, then rebalancing of the longest route. */
+
+//maxClusterRounds bounds the number of assignment and medoid update rounds of the clustering
+const maxClusterRounds = 20
+
+type clusterSolver struct {
+	inst    *MTSPInstance
+	d       [][]int
+	cd      [][]int //the costs of the edges, which are 0 back to the depot for open routes
+	N       int
+	M       int
+	routes  [][]int
+	dist    []int
+	service []int
+	load    []int
+}
+
+//SolveClusterFirst returns routes for all vehicles found by clustering, routing and rebalancing with at most rebalanceMoves moves
+func SolveClusterFirst(inst *MTSPInstance, d [][]int, rebalanceMoves int) ([][]int, error) {
+	N := len(d)
+	M := len(inst.TravelSpeeds)
+	if inst.TimeWindows != nil || inst.MaxVehicles > 0 || inst.FixedCosts != nil {
+		return nil, errors.New("the cluster-first decomposition does not support time windows, a maximal number of vehicles or fixed costs")
+	}
+	cs := clusterSolver{inst: inst, d: d, cd: d, N: N, M: M}
+	if inst.OpenRoutes {
+		cs.cd = openRouteMatrix(d)
+	}
+	clusters := cs.cluster()
+	if clusters == nil {
+		return nil, errors.New("the nodes could not be clustered within the capacities and allowed vehicles")
+	}
+	cs.routes = make([][]int, M)
+	cs.dist = make([]int, M)
+	cs.service = make([]int, M)
+	cs.load = make([]int, M)
+	for i := 0; i < M; i++ {
+		cs.routes[i] = cs.routeCluster(clusters[i])
+		cs.update(i)
+	}
+	Log(2, "Cluster-first: the initial routes have the makespan %d", cs.makespan())
+	if !inst.HasOptionalVehicles() {
+		cs.fillEmptyRoutes()
+	}
+	moves := cs.rebalance(rebalanceMoves)
+	Log(2, "Cluster-first: %d rebalancing moves yield the makespan %d", moves, cs.makespan())
+
+	routes := make([][]int, M)
+	for i := 0; i < M; i++ {
+		if len(cs.routes[i]) == 1 {
+			if !inst.HasOptionalVehicles() {
+				return nil, fmt.Errorf("vehicle %d got no nodes, but all vehicles have to be used", i)
+			}
+			routes[i] = []int{}
+			continue
+		}
+		routes[i] = cs.routes[i]
+		if inst.OpenRoutes {
+			routes[i] = OrientOpenRoute(routes[i], d)
+		}
+	}
+	if valid, comment := CheckSolutionValidity(inst, routes, d, math.MaxInt32); !valid {
+		return nil, fmt.Errorf("the routes are infeasible: %s", comment)
+	}
+	return routes, nil
+}
+
+//cost returns the length of the route of vehicle i
+func (cs *clusterSolver) cost(i int) int {
+	return cs.dist[i]*cs.inst.TravelSpeeds[i] + cs.service[i]
+}
+
+func (cs *clusterSolver) makespan() int {
+	max := 0
+	for i := 0; i < cs.M; i++ {
+		if cs.cost(i) > max {
+			max = cs.cost(i)
+		}
+	}
+	return max
+}
+
+//update recomputes the distance, service time and load of the route of vehicle i
+func (cs *clusterSolver) update(i int) {
+	route := cs.routes[i]
+	cs.dist[i], cs.service[i], cs.load[i] = 0, 0, cs.inst.RouteLoad(route)
+	for p := 0; p < len(route); p++ {
+		cs.dist[i] += cs.cd[route[p]][route[(p+1)%len(route)]]
+		cs.service[i] += cs.inst.ServiceTime(i, route[p])
+	}
+}
+
+//excess returns by how much the route of vehicle i exceeds its duration limit, 0 if it does not
+func (cs *clusterSolver) excess(i int) int {
+	if limit := cs.inst.MaxDuration(i); limit > 0 && cs.cost(i) > limit {
+		return cs.cost(i) - limit
+	}
+	return 0
+}
+
+//fits reports whether vehicle i may serve node j in addition to its load and within its duration limit on the trip 0-j-0
+func (cs *clusterSolver) fits(i int, j int, load int) bool {
+	if !cs.inst.IsAllowed(i, j) {
+		return false
+	}
+	if limit := cs.inst.MaxDuration(i); limit > 0 && cs.inst.RouteCost(i, []int{0, j}, cs.d) > limit {
+		return false
+	}
+	return !cs.inst.IsCapacitated() || load+cs.inst.Demands[j] <= cs.inst.Capacities[i]
+}
+
+//cluster assigns the nodes to the vehicles. Returns nil if some node fits no vehicle
+func (cs *clusterSolver) cluster() [][]int {
+	//each vehicle gets a share of the nodes proportional to its speed
+	speed := cs.inst.aggregateSpeed()
+	shares := make([]int, cs.M)
+	for i := 0; i < cs.M; i++ {
+		shares[i] = int(math.Ceil(float64(cs.N-1) / float64(cs.inst.TravelSpeeds[i]) / speed))
+	}
+	centers := cs.initialCenters()
+	var clusters [][]int
+	for round := 0; round < maxClusterRounds; round++ {
+		clusters = cs.assign(centers, shares)
+		if clusters == nil {
+			return nil
+		}
+		changed := false
+		for i := 0; i < cs.M; i++ {
+			if medoid := cs.medoid(clusters[i], centers[i]); medoid != centers[i] {
+				centers[i] = medoid
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return clusters
+}
+
+//initialCenters chooses the node farthest from the depot and then repeatedly the node farthest from the chosen ones (farthest-first)
+func (cs *clusterSolver) initialCenters() []int {
+	centers := make([]int, cs.M)
+	minDist := make([]int, cs.N)
+	for j := 1; j < cs.N; j++ {
+		minDist[j] = cs.d[0][j]
+	}
+	for i := 0; i < cs.M; i++ {
+		next := 0
+		for j := 1; j < cs.N; j++ {
+			if next == 0 || minDist[j] > minDist[next] {
+				next = j
+			}
+		}
+		centers[i] = next
+		for j := 1; j < cs.N; j++ {
+			if cs.d[next][j] < minDist[j] {
+				minDist[j] = cs.d[next][j]
+			}
+		}
+	}
+	return centers
+}
+
+//assign gives each node to the closest center with a free share, the nodes with the largest regret first.
+//A node, for which no center has a free share, goes to the closest center it fits
+func (cs *clusterSolver) assign(centers []int, shares []int) [][]int {
+	clusters := make([][]int, cs.M)
+	loads := make([]int, cs.M)
+	nodes := make([]int, 0, cs.N-1)
+	regret := make([]int, cs.N)
+	for j := 1; j < cs.N; j++ {
+		nodes = append(nodes, j)
+		first, second := math.MaxInt32, math.MaxInt32
+		for i := 0; i < cs.M; i++ {
+			if dist := cs.d[centers[i]][j]; dist < first {
+				first, second = dist, first
+			} else if dist < second {
+				second = dist
+			}
+		}
+		regret[j] = second - first
+	}
+	sort.SliceStable(nodes, func(a, b int) bool { return regret[nodes[a]] > regret[nodes[b]] })
+	for _, j := range nodes {
+		best := -1
+		for _, withShare := range []bool{true, false} {
+			for i := 0; i < cs.M; i++ {
+				if (withShare && len(clusters[i]) >= shares[i]) || !cs.fits(i, j, loads[i]) {
+					continue
+				}
+				if best < 0 || cs.d[centers[i]][j] < cs.d[centers[best]][j] {
+					best = i
+				}
+			}
+			if best >= 0 {
+				break
+			}
+		}
+		if best < 0 {
+			Log(2, "Cluster-first: node %d fits no vehicle", j)
+			return nil
+		}
+		clusters[best] = append(clusters[best], j)
+		if cs.inst.IsCapacitated() {
+			loads[best] += cs.inst.Demands[j]
+		}
+	}
+	return clusters
+}
+
+//medoid returns the node of the cluster with the smallest sum of distances to the other nodes, or the center if the cluster is empty
+func (cs *clusterSolver) medoid(cluster []int, center int) int {
+	best, bestSum := center, -1
+	for _, j := range cluster {
+		sum := 0
+		for _, k := range cluster {
+			sum += cs.d[j][k]
+		}
+		if bestSum < 0 || sum < bestSum {
+			best, bestSum = j, sum
+		}
+	}
+	return best
+}
+
+//routeCluster returns the route through the depot and the nodes of the cluster built by nearest neighbour and 2-opt
+func (cs *clusterSolver) routeCluster(cluster []int) []int {
+	nodes := append([]int{0}, cluster...)
+	subD := make([][]int, len(nodes))
+	for a := 0; a < len(nodes); a++ {
+		subD[a] = make([]int, len(nodes))
+		for b := 0; b < len(nodes); b++ {
+			subD[a][b] = cs.d[nodes[a]][nodes[b]]
+		}
+	}
+	tour := nearestNeighbourTour(subD, 0)
+	twoOpt(tour, subD)
+	route := make([]int, len(tour))
+	for a := 0; a < len(tour); a++ {
+		route[a] = nodes[tour[a]]
+	}
+	return route
+}
+
+//fillEmptyRoutes moves to each vehicle without nodes the node with the shortest trip 0-j-0 from a route with at least two nodes
+func (cs *clusterSolver) fillEmptyRoutes() {
+	for i := 0; i < cs.M; i++ {
+		if len(cs.routes[i]) > 1 {
+			continue
+		}
+		bestB, bestP, bestCost := -1, -1, 0
+		for b := 0; b < cs.M; b++ {
+			if len(cs.routes[b]) < 3 {
+				continue
+			}
+			for p := 1; p < len(cs.routes[b]); p++ {
+				j := cs.routes[b][p]
+				if !cs.fits(i, j, 0) {
+					continue
+				}
+				if cost := cs.inst.RouteCost(i, []int{0, j}, cs.d); bestB < 0 || cost < bestCost {
+					bestB, bestP, bestCost = b, p, cost
+				}
+			}
+		}
+		if bestB < 0 {
+			Log(2, "Cluster-first: no node can be moved to the empty route of vehicle %d", i)
+			continue
+		}
+		rb := cs.routes[bestB]
+		cs.routes[i] = []int{0, rb[bestP]}
+		cs.routes[bestB] = concat(rb[:bestP], rb[bestP+1:])
+		cs.update(i)
+		cs.update(bestB)
+	}
+}
+
+//rebalance moves nodes from the route exceeding its duration limit the most, or else from the longest route, to the cheapest position
+//of another route, as long as the exceeding or the longest route gets shorter. Returns the number of moves
+func (cs *clusterSolver) rebalance(maxMoves int) int {
+	optional := cs.inst.HasOptionalVehicles()
+	moves := 0
+	for ; moves < maxMoves; moves++ {
+		a := 0
+		for i := 1; i < cs.M; i++ {
+			if cs.excess(i) > cs.excess(a) || (cs.excess(i) == cs.excess(a) && cs.cost(i) > cs.cost(a)) {
+				a = i
+			}
+		}
+		over := cs.excess(a) > 0
+		ra := cs.routes[a]
+		if len(ra) < 2 || (len(ra) == 2 && !optional) {
+			break
+		}
+		bestValue, bestP, bestB, bestQ := cs.cost(a), -1, -1, -1
+		for p := 1; p < len(ra); p++ {
+			j := ra[p]
+			prev, next := ra[p-1], ra[(p+1)%len(ra)]
+			removal := cs.cd[prev][j] + cs.cd[j][next] - cs.cd[prev][next]
+			costA := (cs.dist[a]-removal)*cs.inst.TravelSpeeds[a] + cs.service[a] - cs.inst.ServiceTime(a, j)
+			for b := 0; b < cs.M; b++ {
+				if b == a || !cs.fits(b, j, cs.load[b]) {
+					continue
+				}
+				rb := cs.routes[b]
+				for q := 1; q <= len(rb); q++ {
+					insertion := cs.cd[rb[q-1]][j] + cs.cd[j][rb[q%len(rb)]] - cs.cd[rb[q-1]][rb[q%len(rb)]]
+					costB := (cs.dist[b]+insertion)*cs.inst.TravelSpeeds[b] + cs.service[b] + cs.inst.ServiceTime(b, j)
+					if limit := cs.inst.MaxDuration(b); limit > 0 && costB > limit {
+						continue
+					}
+					value := costA
+					if costB > value && !over {
+						value = costB
+					}
+					if value < bestValue {
+						bestValue, bestP, bestB, bestQ = value, p, b, q
+					}
+				}
+			}
+		}
+		if bestP < 0 {
+			break
+		}
+		j := ra[bestP]
+		cs.routes[a] = concat(ra[:bestP], ra[bestP+1:])
+		rb := cs.routes[bestB]
+		cs.routes[bestB] = concat(rb[:bestQ], []int{j}, rb[bestQ:])
+		if !cs.inst.OpenRoutes {
+			twoOpt(cs.routes[a], cs.d)
+			twoOpt(cs.routes[bestB], cs.d)
+		}
+		cs.update(a)
+		cs.update(bestB)
+	}
+	return moves
+}
@@ -0,0 +1,296 @@
+package mtsp
+
+import (
+	"math"
+	"sort"
+
+	"git.solver4all.com/azaryc2s/gorobi/gurobi"
+)
+
+/* Sparse candidate graphs for the Y variables of the master problem, and the pricing of the missing edges by the reduced costs of the LP relaxation. */
+
+const dblAttrRC = "RC" //reduced costs of the variables
+
+//EdgeSet maps the edges of the candidate graph to their variables. Index[j][k] is the position of the edge (j,k)
+//among the Count edge variables of each vehicle, -1 if the edge is missing
+type EdgeSet struct {
+	Directed bool
+	Count    int
+	Index    [][]int
+}
+
+//NewEdgeSet numbers the edges of the candidate graph in the same order as GetEdgeIndex. candidates nil means all edges
+func NewEdgeSet(N int, directed bool, candidates [][]bool) EdgeSet {
+	es := EdgeSet{Directed: directed, Index: make([][]int, N)}
+	for j := 0; j < N; j++ {
+		es.Index[j] = make([]int, N)
+		for k := 0; k < N; k++ {
+			es.Index[j][k] = -1
+		}
+	}
+	for j := 0; j < N; j++ {
+		for k := 0; k < N; k++ {
+			if k == j || (!directed && k < j) {
+				continue
+			}
+			if candidates != nil && !candidates[j][k] && !candidates[k][j] {
+				continue
+			}
+			es.Index[j][k] = es.Count
+			if !directed {
+				es.Index[k][j] = es.Count
+			}
+			es.Count++
+		}
+	}
+	return es
+}
+
+//EdgeIndex returns the index of the variable of edge (j,k) of vehicle i, or -1 if the edge is missing
+func (es *EdgeSet) EdgeIndex(i, j, k, start int) int {
+	if es.Index[j][k] < 0 {
+		return -1
+	}
+	return start + i*es.Count + es.Index[j][k]
+}
+
+//Has reports whether the edge (j,k) is part of the candidate graph
+func (es *EdgeSet) Has(j, k int) bool {
+	return es.Index[j][k] >= 0
+}
+
+//CandidateEdges returns the adjacency matrix of the candidate graph built with the given strategy, or nil for all edges
+func CandidateEdges(strategy string, d [][]int, coordinates [][]float64, k int) [][]bool {
+	var candidates [][]bool
+	if strategy == EDGES_KNN {
+		candidates = KNearestEdges(d, k)
+	} else if strategy == EDGES_DELAUNAY {
+		if len(coordinates) != len(d) {
+			Log(1, "The delaunay graph needs the coordinates of the nodes, using the %d nearest neighbours instead", k)
+			candidates = KNearestEdges(d, k)
+		} else {
+			candidates = DelaunayEdges(coordinates)
+		}
+	} else if strategy == EDGES_TOURS {
+		candidates = TourEdges(d, k)
+	} else {
+		return nil
+	}
+	count := 0
+	for j := 0; j < len(d); j++ {
+		candidates[0][j] = j != 0
+		candidates[j][0] = j != 0
+		for l := j + 1; l < len(d); l++ {
+			if candidates[j][l] || candidates[l][j] {
+				candidates[j][l] = true
+				candidates[l][j] = true
+				count++
+			}
+		}
+	}
+	Log(2, "The candidate graph %s has %d of %d edges", strategy, count, len(d)*(len(d)-1)/2)
+	return candidates
+}
+
+func newAdjacency(N int) [][]bool {
+	adj := make([][]bool, N)
+	for j := 0; j < N; j++ {
+		adj[j] = make([]bool, N)
+	}
+	return adj
+}
+
+//KNearestEdges connects each node to its k nearest neighbours
+func KNearestEdges(d [][]int, k int) [][]bool {
+	N := len(d)
+	adj := newAdjacency(N)
+	for j := 0; j < N; j++ {
+		nodes := make([]int, 0, N-1)
+		for l := 0; l < N; l++ {
+			if l != j {
+				nodes = append(nodes, l)
+			}
+		}
+		sort.SliceStable(nodes, func(a, b int) bool { return d[j][nodes[a]] < d[j][nodes[b]] })
+		for l := 0; l < k && l < len(nodes); l++ {
+			adj[j][nodes[l]] = true
+			adj[nodes[l]][j] = true
+		}
+	}
+	return adj
+}
+
+//DelaunayEdges returns the edges of the delaunay triangulation of the coordinates (Bowyer-Watson)
+func DelaunayEdges(coordinates [][]float64) [][]bool {
+	N := len(coordinates)
+	adj := newAdjacency(N)
+	if N < 3 {
+		for j := 0; j < N; j++ {
+			for l := 0; l < N; l++ {
+				adj[j][l] = j != l
+			}
+		}
+		return adj
+	}
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, c := range coordinates {
+		minX, minY = math.Min(minX, c[0]), math.Min(minY, c[1])
+		maxX, maxY = math.Max(maxX, c[0]), math.Max(maxY, c[1])
+	}
+	span := math.Max(maxX-minX, maxY-minY) + 1
+	midX, midY := (minX+maxX)/2, (minY+maxY)/2
+	//the super triangle containing all points gets the indices N, N+1 and N+2
+	points := append(append([][]float64{}, coordinates...), []float64{midX - 20*span, midY - span}, []float64{midX, midY + 20*span}, []float64{midX + 20*span, midY - span})
+	triangles := [][3]int{{N, N + 1, N + 2}}
+	for p := 0; p < N; p++ {
+		//remove the triangles whose circumcircle contains the point and retriangulate the hole
+		edgeCount := make(map[[2]int]int)
+		kept := make([][3]int, 0, len(triangles))
+		for _, t := range triangles {
+			if inCircumcircle(points[t[0]], points[t[1]], points[t[2]], points[p]) {
+				for e := 0; e < 3; e++ {
+					a, b := t[e], t[(e+1)%3]
+					if a > b {
+						a, b = b, a
+					}
+					edgeCount[[2]int{a, b}]++
+				}
+			} else {
+				kept = append(kept, t)
+			}
+		}
+		for e, count := range edgeCount {
+			if count == 1 {
+				kept = append(kept, [3]int{e[0], e[1], p})
+			}
+		}
+		triangles = kept
+	}
+	for _, t := range triangles {
+		for e := 0; e < 3; e++ {
+			a, b := t[e], t[(e+1)%3]
+			if a < N && b < N {
+				adj[a][b] = true
+				adj[b][a] = true
+			}
+		}
+	}
+	return adj
+}
+
+//inCircumcircle reports whether p lies inside the circumcircle of the triangle a, b, c
+func inCircumcircle(a, b, c, p []float64) bool {
+	ax, ay := a[0]-p[0], a[1]-p[1]
+	bx, by := b[0]-p[0], b[1]-p[1]
+	cx, cy := c[0]-p[0], c[1]-p[1]
+	det := (ax*ax+ay*ay)*(bx*cy-cx*by) - (bx*bx+by*by)*(ax*cy-cx*ay) + (cx*cx+cy*cy)*(ax*by-bx*ay)
+	orientation := (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+	if orientation < 0 {
+		det = -det
+	}
+	return det > 0
+}
+
+//TourEdges returns the union of the edges of count heuristic tours, built by nearest neighbour from different start nodes and improved by 2-opt
+func TourEdges(d [][]int, count int) [][]bool {
+	N := len(d)
+	adj := newAdjacency(N)
+	for c := 0; c < count && c < N; c++ {
+		start := c * N / count
+		tour := nearestNeighbourTour(d, start)
+		twoOpt(tour, d)
+		for j := 0; j < N; j++ {
+			a, b := tour[j], tour[(j+1)%N]
+			adj[a][b] = true
+			adj[b][a] = true
+		}
+	}
+	return adj
+}
+
+func nearestNeighbourTour(d [][]int, start int) []int {
+	N := len(d)
+	visited := make([]bool, N)
+	tour := []int{start}
+	visited[start] = true
+	for len(tour) < N {
+		last := tour[len(tour)-1]
+		next := -1
+		for k := 0; k < N; k++ {
+			if !visited[k] && (next < 0 || d[last][k] < d[last][next]) {
+				next = k
+			}
+		}
+		visited[next] = true
+		tour = append(tour, next)
+	}
+	return tour
+}
+
+//twoOpt reverses segments of the closed tour as long as this shortens it
+func twoOpt(tour []int, d [][]int) {
+	N := len(tour)
+	for improved := true; improved; {
+		improved = false
+		for a := 0; a < N-1; a++ {
+			for b := a + 2; b < N; b++ {
+				if a == 0 && b == N-1 {
+					continue
+				}
+				c1, c2 := tour[a], tour[a+1]
+				c3, c4 := tour[b], tour[(b+1)%N]
+				if d[c1][c3]+d[c2][c4] < d[c1][c2]+d[c3][c4] {
+					for l, r := a+1, b; l < r; l, r = l+1, r-1 {
+						tour[l], tour[r] = tour[r], tour[l]
+					}
+					improved = true
+				}
+			}
+		}
+	}
+}
+
+//PriceEdges solves the LP relaxation of the master problem over all edges and adds each missing edge to the candidates,
+//that could be part of a solution better than bestObj according to its reduced cost. Returns the number of added edges
+func PriceEdges(gurobiEnv *gurobi.Env, inst *MTSPInstance, d [][]int, masterModel string, subtourIneq string, objective MTSPObjective, candidates [][]bool, bestObj int) (int, error) {
+	model, err := CreateMTSPModel(gurobiEnv, inst, d, gurobi.CONTINUOUS, gurobi.CONTINUOUS, masterModel, subtourIneq, nil, objective)
+	if err != nil {
+		return 0, err
+	}
+	defer model.GModel.Free()
+	err = model.GModel.Optimize()
+	if err != nil {
+		return 0, err
+	}
+	bound, err := model.GModel.GetDblAttr(gurobi.DBL_ATTR_OBJVAL)
+	if err != nil {
+		return 0, err
+	}
+	rc, err := model.GModel.GetDblAttrArray(dblAttrRC, 0, int32(model.VarCount))
+	if err != nil {
+		return 0, err
+	}
+	Log(2, "Pricing the missing edges with the LP bound %.2f and the best objective %d", bound, bestObj)
+	added := 0
+	for j := 0; j < model.N; j++ {
+		for k := j + 1; k < model.N; k++ {
+			if candidates[j][k] || candidates[k][j] {
+				continue
+			}
+			for i := 0; i < model.M && !candidates[j][k]; i++ {
+				for _, e := range [][2]int{{j, k}, {k, j}} {
+					ei := model.EdgeIndex(i, e[0], e[1])
+					//any solution using the edge is at least as bad as the LP bound plus the reduced cost of the edge
+					if (!objective.Prize && bound+rc[ei] < float64(bestObj)-0.5) || (objective.Prize && bound+rc[ei] > float64(bestObj)+0.5) {
+						candidates[j][k] = true
+						candidates[k][j] = true
+						added++
+						break
+					}
+				}
+			}
+		}
+	}
+	Log(2, "Added %d missing edges to the candidate graph", added)
+	return added, nil
+}
@@ -0,0 +1,215 @@
+package mtsp
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+/* Descriptors of an instance (size, speeds, geometry and makespan estimates) for learning which solver configuration suits which instance class. */
+
+//featureNeighbours is the k of the k-nearest-neighbour graph of the clustering coefficient
+const featureNeighbours = 5
+
+//InstanceFeatures are the descriptors of an instance
+type InstanceFeatures struct {
+	Name              string
+	N                 int
+	M                 int
+	SpeedMin          int
+	SpeedMax          int
+	SpeedMean         float64
+	SpeedStd          float64
+	SpeedClasses      int
+	SpreadX           float64 //standard deviation of the x-coordinates
+	SpreadY           float64 //standard deviation of the y-coordinates
+	Clustering        float64 //average local clustering coefficient of the k-nearest-neighbour graph
+	DepotEccentricity float64 //eccentricity of the depot divided by the radius of the graph, 1 for the most central node
+	DepotDistMean     float64 //mean distance from the depot divided by the mean distance of all pairs of nodes
+	NNDistMin         int
+	NNDistMax         int
+	NNDistMean        float64
+	NNDistStd         float64
+	TourLength        int     //length of a nearest neighbour tour improved by 2-opt
+	TourMakespan      float64 //tour and service times split over the vehicles by their speeds
+	FarthestMakespan  float64 //round trip to the farthest node
+	TourRatio         float64 //TourLength / max(TourMakespan, FarthestMakespan), the number of makespans the tour would fill
+	FarthestRatio     float64 //FarthestMakespan / TourMakespan, above 1 the makespan is dominated by a single node
+}
+
+//FeatureNames are the column names of the values returned by CSV
+var FeatureNames = []string{"Name", "N", "M", "SpeedMin", "SpeedMax", "SpeedMean", "SpeedStd", "SpeedClasses", "SpreadX", "SpreadY",
+	"Clustering", "DepotEccentricity", "DepotDistMean", "NNDistMin", "NNDistMax", "NNDistMean", "NNDistStd",
+	"TourLength", "TourMakespan", "FarthestMakespan", "TourRatio", "FarthestRatio"}
+
+//ComputeFeatures returns the descriptors of the instance with the distances d
+func ComputeFeatures(inst *MTSPInstance, d [][]int) InstanceFeatures {
+	N := len(d)
+	f := InstanceFeatures{Name: inst.Name, N: N, M: len(inst.TravelSpeeds)}
+	f.speedFeatures(inst.TravelSpeeds)
+	if len(inst.NodeCoordinates) == N {
+		xs := make([]float64, N)
+		ys := make([]float64, N)
+		for j := 0; j < N; j++ {
+			xs[j], ys[j] = inst.NodeCoordinates[j][0], inst.NodeCoordinates[j][1]
+		}
+		_, f.SpreadX = meanStd(xs)
+		_, f.SpreadY = meanStd(ys)
+	}
+	if N < 2 {
+		return f
+	}
+	f.Clustering = clusteringCoefficient(KNearestEdges(d, featureNeighbours))
+	f.depotFeatures(d)
+	f.neighbourFeatures(d)
+
+	tour := nearestNeighbourTour(d, 0)
+	twoOpt(tour, d)
+	for j := 0; j < N; j++ {
+		f.TourLength += d[tour[j]][tour[(j+1)%N]]
+	}
+	if f.M > 0 {
+		f.TourMakespan = (float64(f.TourLength) + inst.minServiceSum(N)) / inst.aggregateSpeed()
+		f.FarthestMakespan = FarthestNodeBound(inst, d).Value
+		if makespan := math.Max(f.TourMakespan, f.FarthestMakespan); makespan > 0 {
+			f.TourRatio = float64(f.TourLength) / makespan
+		}
+		if f.TourMakespan > 0 {
+			f.FarthestRatio = f.FarthestMakespan / f.TourMakespan
+		}
+	}
+	return f
+}
+
+func (f *InstanceFeatures) speedFeatures(speeds []int) {
+	if len(speeds) == 0 {
+		return
+	}
+	values := make([]float64, len(speeds))
+	classes := make(map[int]bool)
+	f.SpeedMin, f.SpeedMax = speeds[0], speeds[0]
+	for i, s := range speeds {
+		values[i] = float64(s)
+		classes[s] = true
+		if s < f.SpeedMin {
+			f.SpeedMin = s
+		}
+		if s > f.SpeedMax {
+			f.SpeedMax = s
+		}
+	}
+	f.SpeedMean, f.SpeedStd = meanStd(values)
+	f.SpeedClasses = len(classes)
+}
+
+//depotFeatures compares the distances from the depot with the ones from the other nodes
+func (f *InstanceFeatures) depotFeatures(d [][]int) {
+	N := len(d)
+	radius := -1
+	pairSum := 0
+	for j := 0; j < N; j++ {
+		ecc := 0
+		for k := 0; k < N; k++ {
+			if d[j][k] > ecc {
+				ecc = d[j][k]
+			}
+			pairSum += d[j][k]
+		}
+		if radius < 0 || ecc < radius {
+			radius = ecc
+		}
+	}
+	depotEcc, depotSum := 0, 0
+	for k := 1; k < N; k++ {
+		depotSum += d[0][k]
+		if d[0][k] > depotEcc {
+			depotEcc = d[0][k]
+		}
+	}
+	if radius > 0 {
+		f.DepotEccentricity = float64(depotEcc) / float64(radius)
+	}
+	if pairSum > 0 {
+		pairMean := float64(pairSum) / float64(N*(N-1))
+		f.DepotDistMean = float64(depotSum) / float64(N-1) / pairMean
+	}
+}
+
+//neighbourFeatures computes the statistics of the distance of each node to its nearest neighbour
+func (f *InstanceFeatures) neighbourFeatures(d [][]int) {
+	N := len(d)
+	dists := make([]float64, N)
+	for j := 0; j < N; j++ {
+		nearest := -1
+		for k := 0; k < N; k++ {
+			if k != j && (nearest < 0 || d[j][k] < nearest) {
+				nearest = d[j][k]
+			}
+		}
+		dists[j] = float64(nearest)
+		if j == 0 || nearest < f.NNDistMin {
+			f.NNDistMin = nearest
+		}
+		if nearest > f.NNDistMax {
+			f.NNDistMax = nearest
+		}
+	}
+	f.NNDistMean, f.NNDistStd = meanStd(dists)
+}
+
+//clusteringCoefficient returns the average over all nodes of the share of the pairs of their neighbours, that are adjacent as well
+func clusteringCoefficient(adj [][]bool) float64 {
+	N := len(adj)
+	sum := 0.0
+	for j := 0; j < N; j++ {
+		neighbours := make([]int, 0)
+		for k := 0; k < N; k++ {
+			if adj[j][k] {
+				neighbours = append(neighbours, k)
+			}
+		}
+		if len(neighbours) < 2 {
+			continue
+		}
+		links := 0
+		for a := 0; a < len(neighbours); a++ {
+			for b := a + 1; b < len(neighbours); b++ {
+				if adj[neighbours[a]][neighbours[b]] {
+					links++
+				}
+			}
+		}
+		sum += float64(2*links) / float64(len(neighbours)*(len(neighbours)-1))
+	}
+	return sum / float64(N)
+}
+
+//meanStd returns the mean and the standard deviation of the values
+func meanStd(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	return mean, math.Sqrt(variance / float64(len(values)))
+}
+
+//CSV returns the features as one line of comma separated values in the order of FeatureNames
+func (f InstanceFeatures) CSV() string {
+	values := []string{f.Name, fmt.Sprintf("%d", f.N), fmt.Sprintf("%d", f.M), fmt.Sprintf("%d", f.SpeedMin), fmt.Sprintf("%d", f.SpeedMax),
+		fmt.Sprintf("%.4f", f.SpeedMean), fmt.Sprintf("%.4f", f.SpeedStd), fmt.Sprintf("%d", f.SpeedClasses),
+		fmt.Sprintf("%.4f", f.SpreadX), fmt.Sprintf("%.4f", f.SpreadY), fmt.Sprintf("%.4f", f.Clustering),
+		fmt.Sprintf("%.4f", f.DepotEccentricity), fmt.Sprintf("%.4f", f.DepotDistMean),
+		fmt.Sprintf("%d", f.NNDistMin), fmt.Sprintf("%d", f.NNDistMax), fmt.Sprintf("%.4f", f.NNDistMean), fmt.Sprintf("%.4f", f.NNDistStd),
+		fmt.Sprintf("%d", f.TourLength), fmt.Sprintf("%.4f", f.TourMakespan), fmt.Sprintf("%.4f", f.FarthestMakespan),
+		fmt.Sprintf("%.4f", f.TourRatio), fmt.Sprintf("%.4f", f.FarthestRatio)}
+	return strings.Join(values, ",")
+}
+
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"git.solver4all.com/azaryc2s/mtsp"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+)
+
+//prints the features of all instances in the directory as CSV, joinable by the Name with the output of the analyzer
+func main() {
+	if len(os.Args) < 2 {
+		log.Printf("No arguments passed!")
+		return
+	}
+	dirName := os.Args[1]
+	dir, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		log.Printf("Couldn't open directory %s: %s\n", os.Args[1], err.Error())
+		return
+	}
+	fmt.Printf("%s\n", strings.Join(mtsp.FeatureNames, ","))
+	for _, f := range dir {
+		fileName := dirName + "/" + f.Name()
+		if strings.Contains(fileName, ".json") {
+			inst := mtsp.MTSPInstance{}
+			instStr, err := ioutil.ReadFile(fileName)
+			if err != nil {
+				log.Printf("Couldn't read %s: %s\n", f.Name(), err.Error())
+				return
+			}
+			err = json.Unmarshal(instStr, &inst)
+			if err != nil {
+				log.Printf("Couldn't parse %s: %s\n", f.Name(), err.Error())
+				return
+			}
+			d := mtsp.CalcEdgeDist(inst.NodeCoordinates, inst.EdgeWeightType)
+			fmt.Printf("%s\n", mtsp.ComputeFeatures(&inst, d).CSV())
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package mtsp
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"git.solver4all.com/azaryc2s/gorobi/gurobi"
+)
+
+/* Bound-based variable fixing: assignments and edges, whose shortest trip from the depot exceeds the bound on the route, are fixed to zero. */
+
+//tripLength returns the length of the shortest route of vehicle i visiting the given nodes in this order, or MaxInt32 if there is none
+func (model *MTSPModel) tripLength(i int, nodes ...int) int {
+	length, inTime := model.schedule(i, append([]int{0}, nodes...), model.tripD)
+	if !inTime {
+		return math.MaxInt32
+	}
+	return length
+}
+
+//initTrips computes the trip lengths of all assignment and edge variables
+func (model *MTSPModel) initTrips() {
+	N := model.N
+	model.tripD = ShortestPaths(model.EdgeWeights)
+	model.tripX = make([]int, model.XCount)
+	model.tripY = make([]int, model.YCount)
+	model.fixedX = make([]bool, model.XCount)
+	model.fixedY = make([]bool, model.YCount)
+	for i := 0; i < model.M; i++ {
+		for j := 1; j < N; j++ {
+			xi := GetNodeIndex(i, j, N, 0)
+			model.tripX[xi] = model.tripLength(i, j)
+			if model.Allowed != nil && !model.Allowed[i][j] {
+				//already fixed by the compatibility constraints
+				model.fixedX[xi] = true
+			}
+		}
+		for j := 0; j < N; j++ {
+			for k := 0; k < N; k++ {
+				ei := model.EdgeIndex(i, j, k)
+				if k == j || ei < 0 || (model.GMastermodel != MASTERMODEL_ATSP && k < j) {
+					continue
+				}
+				var trip int
+				if j == 0 {
+					trip = model.tripLength(i, k)
+				} else if k == 0 {
+					trip = model.tripLength(i, j)
+				} else if model.GMastermodel == MASTERMODEL_ATSP {
+					trip = model.tripLength(i, j, k)
+				} else {
+					trip = int(math.Min(float64(model.tripLength(i, j, k)), float64(model.tripLength(i, k, j))))
+				}
+				model.tripY[ei-model.YStart] = trip
+			}
+		}
+	}
+}
+
+//ShortestPaths returns the lengths of the shortest paths between all nodes (Floyd-Warshall)
+func ShortestPaths(d [][]int) [][]int {
+	N := len(d)
+	sp := make([][]int, N)
+	for j := 0; j < N; j++ {
+		sp[j] = append([]int{}, d[j]...)
+	}
+	for l := 0; l < N; l++ {
+		for j := 0; j < N; j++ {
+			for k := 0; k < N; k++ {
+				if sp[j][l]+sp[l][k] < sp[j][k] {
+					sp[j][k] = sp[j][l] + sp[l][k]
+				}
+			}
+		}
+	}
+	return sp
+}
+
+//fixingBound returns the bound on the length of the route of vehicle i, 0 if there is none
+func (model *MTSPModel) fixingBound(i int) int {
+	bound := model.durationLimit(i)
+	o := model.Objective
+	if model.BestSol.Routes != nil && o.WCMax > 0 && o.WTotal == 0 && o.Levels == nil && !o.Prize && model.FixedCosts == nil {
+		//the objective only consists of the makespan, so no route of a better solution can be longer than the best objective
+		if ub := model.BestSol.Obj / o.WCMax; bound <= 0 || ub < bound {
+			bound = ub
+		}
+	}
+	return bound
+}
+
+//fixableVariables returns for each vehicle the indices of the variables, that can be fixed to zero since the last call
+func (model *MTSPModel) fixableVariables() (fixed [][]int32) {
+	if model.tripX == nil {
+		model.initTrips()
+	}
+	N := model.N
+	fixed = make([][]int32, model.M)
+	for i := 0; i < model.M; i++ {
+		bound := model.fixingBound(i)
+		if bound <= 0 {
+			continue
+		}
+		for j := 1; j < N; j++ {
+			xi := GetNodeIndex(i, j, N, 0)
+			if !model.fixedX[xi] && model.tripX[xi] > bound {
+				model.fixedX[xi] = true
+				model.FixedXCount++
+				fixed[i] = append(fixed[i], int32(model.XStart+xi))
+			}
+		}
+		for e := i * model.Edges.Count; e < (i+1)*model.Edges.Count; e++ {
+			if !model.fixedY[e] && model.tripY[e] > bound {
+				model.fixedY[e] = true
+				model.FixedYCount++
+				fixed[i] = append(fixed[i], int32(model.YStart+e))
+			}
+		}
+	}
+	return fixed
+}
+
+//FixVariables adds the constraints sum(X_ij) + sum(Y_ijk) <= 0 for the assignments and edges of each vehicle,
+//that are longer than the bound of its route. Returns the number of fixed variables
+func (model *MTSPModel) FixVariables() (int, error) {
+	fixed := model.fixableVariables()
+	count := 0
+	for i := 0; i < len(fixed); i++ {
+		if len(fixed[i]) == 0 {
+			continue
+		}
+		count += len(fixed[i])
+		val := make([]float64, len(fixed[i]))
+		for v := 0; v < len(val); v++ {
+			val[v] = 1.0
+		}
+		err := model.GModel.AddConstr(fixed[i], val, gurobi.LESS_EQUAL, 0.0, fmt.Sprintf("FIX_%d_%d", i, model.FixedXCount+model.FixedYCount))
+		if err != nil {
+			model.log(1, "Error fixing the variables of vehicle %d: %s\n", i, err.Error())
+			return count, err
+		}
+	}
+	model.log(2, "Fixed %d variables, in total %d of %d assignment and %d of %d edge variables", count, model.FixedXCount, model.XCount, model.FixedYCount, model.YCount)
+	return count, nil
+}
+
+//fixVariablesLazy adds the fixing constraints for the variables, that can be fixed since the last improvement of the best solution, as lazy constraints
+func fixVariablesLazy(model *MTSPModel, cbdata gurobi.CPVoid) {
+	fixed := model.fixableVariables()
+	count := 0
+	for i := 0; i < len(fixed); i++ {
+		if len(fixed[i]) == 0 {
+			continue
+		}
+		count += len(fixed[i])
+		val := make([]float64, len(fixed[i]))
+		for v := 0; v < len(val); v++ {
+			val[v] = 1.0
+		}
+		err := gurobi.CbLazy(cbdata, len(fixed[i]), fixed[i], val, gurobi.LESS_EQUAL, 0.0)
+		if err != nil {
+			model.log(1, err.Error())
+		}
+	}
+	if count > 0 {
+		model.log(3, "Fixed %d variables with the new best objective %d", count, model.BestSol.Obj)
+	}
+}
+
+//SetInitialSolution sets the routes as the best known solution, which is passed to gurobi at the first node.
+//Returns false if the routes are not a feasible solution of the model
+func (model *MTSPModel) SetInitialSolution(routes [][]int) bool {
+	costs := make([]int, len(routes))
+	for i := 0; i < len(routes); i++ {
+		if len(routes[i]) == 0 {
+			if !model.Optional {
+				model.log(2, "The initial solution leaves vehicle %d unused and can not be set", i)
+				return false
+			}
+			continue
+		}
+		length, inTime := model.schedule(i, routes[i], model.EdgeWeights)
+		if !inTime || (model.durationLimit(i) > 0 && length > model.durationLimit(i)) {
+			model.log(2, "The initial route %v of vehicle %d is infeasible", routes[i], i)
+			return false
+		}
+		costs[i] = length
+	}
+	if !model.isCompatible(routes) || !model.isLoadFeasible(routes) || !model.isWithinLevels(costs) {
+		return false
+	}
+	obj := model.objValue(routes, costs)
+	if !model.isBetter(obj, model.BestSol.Obj) {
+		return false
+	}
+	model.log(2, "Setting the initial solution with objective %d", obj)
+	model.BestSol.Obj = obj
+	model.BestSol.Routes = routes
+	model.BestSol.RouteCosts = costs
+	model.NewBestSol = true
+	return true
+}
+
+//InsertionHeuristic builds routes by inserting the nodes, the ones farthest from the depot first, at the position and vehicle
+//resulting in the shortest route. Vehicles without nodes get empty routes. Returns nil if some node can not be inserted
+func (inst *MTSPInstance) InsertionHeuristic(d [][]int) [][]int {
+	M := len(inst.TravelSpeeds)
+	routes := make([][]int, M)
+	for i := 0; i < M; i++ {
+		routes[i] = []int{0}
+	}
+	nodes := make([]int, 0, len(d))
+	for j := 1; j < len(d); j++ {
+		nodes = append(nodes, j)
+	}
+	sort.SliceStable(nodes, func(a, b int) bool { return d[0][nodes[a]] > d[0][nodes[b]] })
+	for _, j := range nodes {
+		var bestRoute []int
+		bestI := -1
+		bestLength := 0
+		for i := 0; i < M; i++ {
+			if !inst.IsAllowed(i, j) || (inst.IsCapacitated() && inst.RouteLoad(routes[i])+inst.Demands[j] > inst.Capacities[i]) {
+				continue
+			}
+			for p := 1; p <= len(routes[i]); p++ {
+				cand := make([]int, 0, len(routes[i])+1)
+				cand = append(cand, routes[i][:p]...)
+				cand = append(cand, j)
+				cand = append(cand, routes[i][p:]...)
+				length, inTime := inst.RouteSchedule(i, cand, d)
+				if !inTime || (inst.MaxDuration(i) > 0 && length > inst.MaxDuration(i)) {
+					continue
+				}
+				if bestI < 0 || length < bestLength {
+					bestI, bestLength, bestRoute = i, length, cand
+				}
+			}
+		}
+		if bestI < 0 {
+			Log(2, "The insertion heuristic could not insert node %d", j)
+			return nil
+		}
+		routes[bestI] = bestRoute
+	}
+	for i := 0; i < M; i++ {
+		if len(routes[i]) == 1 {
+			routes[i] = []int{}
+		}
+	}
+	return routes
+}
@@ -16,6 +16,7 @@ import (
 )
 
 var speeds mtsp.ArrayStringFlags
+var demands mtsp.ArrayStringFlags
 var nodes mtsp.ArrayIntFlags
 var vehicles mtsp.ArrayIntFlags
 var name *string
@@ -28,9 +29,14 @@ var vehGroupSize *int
 var xTo *int
 var yTo *int
 var w *string
+var demandMax *int
+var demandClusters *int
+var capFactor *float64
+var compatDensity *float64
 
 func main() {
 	flag.Var(&speeds, "s", "List of speed-generation strategies. (ONE|RNG|RNG-GROUP)")
+	flag.Var(&demands, "q", "List of demand-generation strategies. By default no demands are generated. (UNIT|UNIFORM|CLUSTERED)")
 	flag.Var(&nodes, "n", "List of number of nodes")
 	flag.Var(&vehicles, "m", "List of number of vehicles")
 	name = flag.String("name", "zarychta", "Name for the instance")
@@ -44,8 +50,15 @@ func main() {
 	xTo = flag.Int("x", 10000, "Max value on the x-axis")
 	yTo = flag.Int("y", 10000, "Max value on the y-axis")
 	w = flag.String("w", "EUC_2D", "EDGE_WEIGHT_TYPE - how the distance between nodes is calculated.")
+	demandMax = flag.Int("qMax", 100, "The highest demand of a node, when using uniform or clustered demand strategy")
+	demandClusters = flag.Int("qClusters", 3, "The number of demand clusters, when using clustered demand strategy")
+	capFactor = flag.Float64("capFactor", 1.2, "Ratio of the total vehicle capacity to the total demand")
+	compatDensity = flag.Float64("compat", 1.0, "Probability of a vehicle being allowed to serve a node. With 1.0 (default) there are no restrictions")
 
 	flag.Parse()
+	if len(demands) == 0 {
+		demands = mtsp.ArrayStringFlags{""}
+	}
 	var fileInst []mtsp.TSPInstance
 	var genFromFiles bool
 	if *input != "" {
@@ -134,19 +147,39 @@ func main() {
 						}
 					}
 
-					comment := fmt.Sprintf("%s instance Nr. %d with %d nodes, %d vehicles and speeds generated as %s", *name, l, n, m, s)
-					instName := fmt.Sprintf("%s_%d_%d_%s_%d", *name, n, m, s, l)
-					hmmVRPInstance := mtsp.MTSPInstance{Name: instName, Comment: comment, Type: "hmmVRP", NodeCount: n, VehicleCount: m, TravelSpeeds: speedsArray, NodeCoordinates: coordinatesArray, Depots: depots, DisplayDataType: "COORD_DISPLAY", EdgeWeightType: *w}
+					for dm := 0; dm < len(demands); dm++ {
+						q := demands[dm]
+						comment := fmt.Sprintf("%s instance Nr. %d with %d nodes, %d vehicles and speeds generated as %s", *name, l, n, m, s)
+						instName := fmt.Sprintf("%s_%d_%d_%s_%d", *name, n, m, s, l)
+						if q != "" {
+							comment += fmt.Sprintf(" and demands generated as %s", q)
+							instName = fmt.Sprintf("%s_%d_%d_%s_%s_%d", *name, n, m, s, q, l)
+						}
+						hmmVRPInstance := mtsp.MTSPInstance{Name: instName, Comment: comment, Type: "hmmVRP", NodeCount: n, VehicleCount: m, TravelSpeeds: speedsArray, NodeCoordinates: coordinatesArray, Depots: depots, DisplayDataType: "COORD_DISPLAY", EdgeWeightType: *w}
+						if genFromFiles {
+							//keep the prices and the maximum route duration of orienteering instances
+							hmmVRPInstance.Prices = fileInst[i].Prices
+							hmmVRPInstance.TMax = fileInst[i].TMax
+						}
+						if *compatDensity < 1.0 {
+							hmmVRPInstance.AllowedVehicles = generateAllowedVehicles(n, m)
+						}
+						if q != "" {
+							hmmVRPInstance.Type = "hmmCVRP"
+							hmmVRPInstance.Demands = generateDemands(q, coordinatesArray)
+							hmmVRPInstance.Capacities = generateCapacities(hmmVRPInstance.Demands, m)
+						}
 
-					jsonInst, err := json.MarshalIndent(hmmVRPInstance, "", "\t")
-					if err != nil {
-						log.Fatal(err)
-					}
+						jsonInst, err := json.MarshalIndent(hmmVRPInstance, "", "\t")
+						if err != nil {
+							log.Fatal(err)
+						}
 
-					jsonInst = []byte(sanitizeJsonArrayLineBreaks(string(jsonInst)))
-					err = ioutil.WriteFile(fmt.Sprintf("%s/%s.json", *output, instName), jsonInst, 0644)
-					if err != nil {
-						log.Fatal(err)
+						jsonInst = []byte(sanitizeJsonArrayLineBreaks(string(jsonInst)))
+						err = ioutil.WriteFile(fmt.Sprintf("%s/%s.json", *output, instName), jsonInst, 0644)
+						if err != nil {
+							log.Fatal(err)
+						}
 					}
 				}
 			}
@@ -154,6 +187,107 @@ func main() {
 	}
 }
 
+//generateAllowedVehicles allows each vehicle to serve each node with probability compatDensity.
+//Every node can be served by at least one vehicle and every vehicle can serve at least one node
+func generateAllowedVehicles(n int, m int) [][]int {
+	allowed := make([][]int, n)
+	allowed[0] = make([]int, 0)
+	used := make([]bool, m)
+	for j := 1; j < n; j++ {
+		allowed[j] = make([]int, 0)
+		for i := 0; i < m; i++ {
+			if rand.Float64() < *compatDensity {
+				allowed[j] = append(allowed[j], i)
+				used[i] = true
+			}
+		}
+		if len(allowed[j]) == 0 {
+			i := rand.Intn(m)
+			allowed[j] = append(allowed[j], i)
+			used[i] = true
+		}
+	}
+	for i := 0; i < m && n > 1; i++ {
+		//without nodes besides the depot the vehicles can not serve any
+		if !used[i] {
+			j := 1 + rand.Intn(n-1)
+			allowed[j] = append(allowed[j], i)
+		}
+	}
+	return allowed
+}
+
+//generateDemands creates a demand for every node except the depot according to the given strategy.
+//With the clustered strategy, nodes get demands similar to the random cluster center closest to them
+func generateDemands(strat string, coordinates [][]float64) []int {
+	n := len(coordinates)
+	q := make([]int, n)
+	if strat == mtsp.DEMAND_UNIT {
+		for j := 1; j < n; j++ {
+			q[j] = 1
+		}
+	} else if strat == mtsp.DEMAND_UNIFORM {
+		for j := 1; j < n; j++ {
+			q[j] = 1 + rand.Intn(*demandMax)
+		}
+	} else if strat == mtsp.DEMAND_CLUSTERED {
+		if n < 2 {
+			//only the depot, there are no nodes to place the centers on
+			return q
+		}
+		c := int(math.Max(float64(*demandClusters), 1.0))
+		centers := make([][]float64, c)
+		base := make([]int, c)
+		for k := 0; k < c; k++ {
+			centers[k] = coordinates[1+rand.Intn(n-1)]
+			base[k] = 1 + rand.Intn(*demandMax)
+		}
+		spread := int(math.Max(float64(*demandMax/10), 1.0))
+		for j := 1; j < n; j++ {
+			closest := 0
+			minDist := -1.0
+			for k := 0; k < c; k++ {
+				dist := math.Pow(coordinates[j][0]-centers[k][0], 2) + math.Pow(coordinates[j][1]-centers[k][1], 2)
+				if minDist < 0 || dist < minDist {
+					minDist = dist
+					closest = k
+				}
+			}
+			q[j] = base[closest] + rand.Intn(2*spread+1) - spread
+			if q[j] < 1 {
+				q[j] = 1
+			} else if q[j] > *demandMax {
+				q[j] = *demandMax
+			}
+		}
+	} else {
+		log.Fatalf("Unsupported demand strategy: %s", strat)
+	}
+	return q
+}
+
+//generateCapacities gives every vehicle the same capacity, so that the fleet can carry capFactor times the total demand.
+//Each vehicle can carry at least the largest single demand
+func generateCapacities(q []int, m int) []int {
+	total := 0
+	maxQ := 0
+	for j := 0; j < len(q); j++ {
+		total += q[j]
+		if q[j] > maxQ {
+			maxQ = q[j]
+		}
+	}
+	c := int(math.Ceil(float64(total) * *capFactor / float64(m)))
+	if c < maxQ {
+		c = maxQ
+	}
+	capacities := make([]int, m)
+	for i := 0; i < m; i++ {
+		capacities[i] = c
+	}
+	return capacities
+}
+
 func sanitizeJsonArrayLineBreaks(json string) string {
 	res := fmt.Sprintf("%s", json)
 	var numbers = regexp.MustCompile(`\s*([-]?[0-9]+(\.[0-9]+)?),\s+([-]?[0-9]+(\.[0-9]+)?)(,)?`)
@@ -0,0 +1,145 @@
+package mtsp
+
+import (
+	"fmt"
+	"math"
+
+	"git.solver4all.com/azaryc2s/gorobi/gurobi"
+	"git.solver4all.com/azaryc2s/tsp"
+)
+
+/* Lower bounds on the makespan from the aggregate speed of the vehicles, a spanning tree, a TSP tour and the farthest node. */
+
+//LowerBound is a lower bound on the makespan together with the strategy, that computed it
+type LowerBound struct {
+	Strategy string
+	Value    float64
+}
+
+//aggregateSpeed returns sum_i 1/s_i
+func (inst *MTSPInstance) aggregateSpeed() float64 {
+	speed := 0.0
+	for i := 0; i < len(inst.TravelSpeeds); i++ {
+		speed += 1.0 / float64(inst.TravelSpeeds[i])
+	}
+	return speed
+}
+
+//minServiceSum returns the time, that the vehicles spend at least at the N nodes, scaled by their speeds as sum_j min_i st_ij/s_i
+func (inst *MTSPInstance) minServiceSum(N int) float64 {
+	sum := 0.0
+	for j := 1; j < N; j++ {
+		min := math.Inf(1)
+		for i := 0; i < len(inst.TravelSpeeds); i++ {
+			if inst.IsAllowed(i, j) {
+				min = math.Min(min, float64(inst.ServiceTime(i, j))/float64(inst.TravelSpeeds[i]))
+			}
+		}
+		if !math.IsInf(min, 1) {
+			sum += min
+		}
+	}
+	return sum
+}
+
+//FarthestNodeBound returns the longest round trip to a single node, each on the fastest vehicle allowed to serve it
+func FarthestNodeBound(inst *MTSPInstance, d [][]int) LowerBound {
+	bound := 0
+	for j := 1; j < len(d); j++ {
+		trip := -1
+		for i := 0; i < len(inst.TravelSpeeds); i++ {
+			if !inst.IsAllowed(i, j) {
+				continue
+			}
+			length, inTime := inst.RouteSchedule(i, []int{0, j}, d)
+			if inTime && (trip < 0 || length < trip) {
+				trip = length
+			}
+		}
+		if trip > bound {
+			bound = trip
+		}
+	}
+	return LowerBound{LBSTRAT_FARTHEST, float64(bound)}
+}
+
+//TreeBound divides the length of a minimum spanning tree over all nodes by the aggregate speed. If every vehicle drives a closed route,
+//it leaves and returns to the depot, so removing one depot edge from each route still leaves a spanning tree (1-tree bound)
+func TreeBound(inst *MTSPInstance, d [][]int) LowerBound {
+	N := len(d)
+	length := float64(MinSpanningTree(d))
+	if !inst.OpenRoutes && !inst.HasOptionalVehicles() {
+		minDepotEdge := -1
+		for j := 1; j < N; j++ {
+			if minDepotEdge < 0 || d[0][j] < minDepotEdge {
+				minDepotEdge = d[0][j]
+			}
+		}
+		length += float64(len(inst.TravelSpeeds) * minDepotEdge)
+	}
+	return LowerBound{LBSTRAT_MST, (length + inst.minServiceSum(N)) / inst.aggregateSpeed()}
+}
+
+//MinSpanningTree returns the length of a minimum spanning tree of the complete graph (Prim)
+func MinSpanningTree(d [][]int) int {
+	N := len(d)
+	inTree := make([]bool, N)
+	dist := make([]int, N)
+	for j := 0; j < N; j++ {
+		dist[j] = math.MaxInt32
+	}
+	dist[0] = 0
+	length := 0
+	for n := 0; n < N; n++ {
+		next := -1
+		for j := 0; j < N; j++ {
+			if !inTree[j] && (next < 0 || dist[j] < dist[next]) {
+				next = j
+			}
+		}
+		inTree[next] = true
+		length += dist[next]
+		for j := 0; j < N; j++ {
+			if !inTree[j] && d[next][j] < dist[j] {
+				dist[j] = d[next][j]
+			}
+		}
+	}
+	return length
+}
+
+//TSPBound divides the length of an optimal TSP tour by the aggregate speed. The closed routes all pass the depot,
+//so they can be joined to one tour, which is not longer than their sum by the triangle inequality. Returns the bound and the TSP length
+func TSPBound(gurobiEnv *gurobi.Env, inst *MTSPInstance, d [][]int) (LowerBound, int) {
+	_, tspLength, _ := tsp.SolveTSP(d, gurobiEnv)
+	return LowerBound{LBSTRAT_TSP, (float64(tspLength) + inst.minServiceSum(len(d))) / inst.aggregateSpeed()}, tspLength
+}
+
+//LPBound returns the makespan of the LP relaxation of the master problem over all edges
+func LPBound(gurobiEnv *gurobi.Env, inst *MTSPInstance, d [][]int, masterModel string, subtourIneq string) (LowerBound, error) {
+	model, err := CreateMTSPModel(gurobiEnv, inst, d, gurobi.CONTINUOUS, gurobi.CONTINUOUS, masterModel, subtourIneq, nil, MTSPObjective{WCMax: 1})
+	if err != nil {
+		return LowerBound{LBSTRAT_LP, 0}, err
+	}
+	defer model.GModel.Free()
+	err = model.GModel.Optimize()
+	if err != nil {
+		return LowerBound{LBSTRAT_LP, 0}, err
+	}
+	bound, err := model.GModel.GetDblAttr(gurobi.DBL_ATTR_OBJVAL)
+	if err != nil {
+		return LowerBound{LBSTRAT_LP, 0}, err
+	}
+	return LowerBound{LBSTRAT_LP, bound}, nil
+}
+
+//SetCMaxLowerBound adds the constraint CMax >= lb.Value, rounded up since all route lengths are integral
+func (model *MTSPModel) SetCMaxLowerBound(lb LowerBound) error {
+	rhs := math.Ceil(lb.Value - 1e-6)
+	err := model.GModel.AddConstr([]int32{int32(model.CMax)}, []float64{1.0}, gurobi.GREATER_EQUAL, rhs, fmt.Sprintf("LBOUND_%s", lb.Strategy))
+	if err != nil {
+		return err
+	}
+	Log(2, "Set the %s lower bound: CMax >= %.0f", lb.Strategy, rhs)
+	return nil
+}
@@ -0,0 +1,299 @@
+package mtsp
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"git.solver4all.com/azaryc2s/gorobi/gurobi"
+)
+
+/* Large neighbourhood search, destroying parts of the solution adaptively (LNS_VEHICLES, LNS_REGION) and repairing them with the branch-and-check. */
+
+//scores of the destroy operators for a new best solution, an accepted solution of the same objective and a rejected one
+const (
+	lnsScoreBest     = 3.0
+	lnsScoreAccepted = 1.0
+	lnsScoreRejected = 0.0
+	lnsMinWeight     = 0.1
+	dblParTimeLimit  = "TimeLimit"
+)
+
+//LNSParams configures the large neighbourhood search
+type LNSParams struct {
+	Iterations      int
+	TimeLimit       time.Duration
+	DestroyVehicles int     //number of vehicles freed by LNS_VEHICLES
+	DestroyNodes    int     //number of nodes freed by LNS_REGION
+	Reaction        float64 //weight of the last score, when the weights of the destroy operators are updated
+	Seed            int64
+	MasterModel     string
+	SubtourIneq     string
+	YType           int8
+	Cuts            ArrayStringFlags
+}
+
+type lnsSolver struct {
+	env       *gurobi.Env
+	inst      *MTSPInstance
+	d         [][]int
+	objective MTSPObjective
+	params    LNSParams
+	eval      *MTSPModel
+	rnd       *rand.Rand
+	deadline  time.Time //end of the time limit, zero if there is none
+}
+
+//newRouteModel returns a model without gurobi, that only evaluates and improves routes of the instance
+func newRouteModel(inst *MTSPInstance, d [][]int, objective MTSPObjective) *MTSPModel {
+	N := len(d)
+	model := &MTSPModel{EdgeWeights: d, TravelSpeeds: inst.TravelSpeeds, ServiceTimes: inst.ServiceTimeMatrix(N), TimeWindows: inst.TimeWindows, Prices: inst.Prices,
+		Allowed: inst.AllowedMatrix(N), OpenRoutes: inst.OpenRoutes, Optional: inst.HasOptionalVehicles() || objective.Prize, FixedCosts: inst.FixedCosts,
+		MaxDurations: inst.MaxDurations, N: N, M: len(inst.TravelSpeeds), Objective: objective}
+	if inst.IsCapacitated() {
+		model.Demands = inst.Demands
+		model.Capacities = inst.Capacities
+	}
+	model.schedule = func(i int, route []int, d [][]int) (int, bool) { return inst.RouteSchedule(i, route, d) }
+	return model
+}
+
+//ObjectiveValue returns the objective value of the routes
+func (inst *MTSPInstance) ObjectiveValue(routes [][]int, d [][]int, objective MTSPObjective) int {
+	costs := make([]int, len(routes))
+	for i := 0; i < len(routes); i++ {
+		costs[i] = inst.RouteCost(i, routes[i], d)
+	}
+	return newRouteModel(inst, d, objective).objValue(routes, costs)
+}
+
+//SolveLNS improves the solution of the insertion heuristic by the large neighbourhood search. Returns the best routes and their objective value
+func SolveLNS(gurobiEnv *gurobi.Env, inst *MTSPInstance, d [][]int, objective MTSPObjective, params LNSParams) (routes [][]int, obj int, err error) {
+	if objective.Prize || objective.Levels != nil {
+		return nil, 0, errors.New("the LNS does not support the prize or balancing objectives")
+	}
+	lns := lnsSolver{env: gurobiEnv, inst: inst, d: d, objective: objective, params: params, eval: newRouteModel(inst, d, objective), rnd: rand.New(rand.NewSource(params.Seed))}
+	routes = inst.InsertionHeuristic(d)
+	if routes == nil || !lns.eval.SetInitialSolution(routes) {
+		return nil, 0, errors.New("the insertion heuristic found no initial solution")
+	}
+	routes, costs, obj := lns.eval.ImproveSolution(routes, lns.eval.BestSol.RouteCosts)
+	Log(2, "LNS: the initial solution has the objective %d", obj)
+
+	operators := []string{LNS_VEHICLES, LNS_REGION}
+	weights := []float64{1.0, 1.0}
+	startTime := time.Now()
+	if params.TimeLimit > 0 {
+		lns.deadline = startTime.Add(params.TimeLimit)
+	}
+	for it := 0; it < params.Iterations && (params.TimeLimit <= 0 || time.Since(startTime) < params.TimeLimit); it++ {
+		op := lns.chooseOperator(weights)
+		var vehicles []int
+		var free []bool
+		if operators[op] == LNS_VEHICLES {
+			vehicles, free = lns.destroyVehicles(routes, costs)
+		} else {
+			vehicles, free = lns.destroyRegion(routes)
+		}
+		repaired, err := lns.repair(routes, vehicles, free)
+		if err != nil {
+			return routes, obj, err
+		}
+		score := lnsScoreRejected
+		if repaired != nil {
+			newCosts := make([]int, len(repaired))
+			for i := 0; i < len(repaired); i++ {
+				newCosts[i] = inst.RouteCost(i, repaired[i], d)
+			}
+			var newObj int
+			repaired, newCosts, newObj = lns.eval.ImproveSolution(repaired, newCosts)
+			if lns.eval.isBetter(newObj, obj) {
+				score = lnsScoreBest
+			} else if newObj == obj {
+				score = lnsScoreAccepted
+			}
+			if score > lnsScoreRejected {
+				routes, costs, obj = repaired, newCosts, newObj
+			}
+		}
+		weights[op] = (1-params.Reaction)*weights[op] + params.Reaction*score
+		if weights[op] < lnsMinWeight {
+			weights[op] = lnsMinWeight
+		}
+		Log(2, "LNS iteration %d: %s destroyed the routes of vehicles %v, objective %d, weights %v", it, operators[op], vehicles, obj, weights)
+	}
+	return routes, obj, nil
+}
+
+//chooseOperator returns a destroy operator with a probability proportional to its weight
+func (lns *lnsSolver) chooseOperator(weights []float64) int {
+	sum := 0.0
+	for _, w := range weights {
+		sum += w
+	}
+	r := lns.rnd.Float64() * sum
+	for op, w := range weights {
+		if r < w {
+			return op
+		}
+		r -= w
+	}
+	return len(weights) - 1
+}
+
+//destroyVehicles frees all nodes of the vehicle with the longest route and of further random vehicles
+func (lns *lnsSolver) destroyVehicles(routes [][]int, costs []int) (vehicles []int, free []bool) {
+	free = make([]bool, len(lns.d))
+	longest := 0
+	for i := 1; i < len(costs); i++ {
+		if costs[i] > costs[longest] {
+			longest = i
+		}
+	}
+	vehicles = []int{longest}
+	for _, i := range lns.rnd.Perm(len(routes)) {
+		if len(vehicles) >= lns.params.DestroyVehicles {
+			break
+		}
+		if i != longest {
+			vehicles = append(vehicles, i)
+		}
+	}
+	for _, i := range vehicles {
+		for _, j := range routes[i] {
+			free[j] = j != 0
+		}
+	}
+	sort.Ints(vehicles)
+	return vehicles, free
+}
+
+//destroyRegion frees the nodes closest to a random node. The vehicles serving them are destroyed,
+//and a random further vehicle, if they are all served by the same one
+func (lns *lnsSolver) destroyRegion(routes [][]int) (vehicles []int, free []bool) {
+	N := len(lns.d)
+	free = make([]bool, N)
+	center := 1 + lns.rnd.Intn(N-1)
+	nodes := make([]int, 0, N-1)
+	for j := 1; j < N; j++ {
+		nodes = append(nodes, j)
+	}
+	sort.SliceStable(nodes, func(a, b int) bool { return lns.d[center][nodes[a]] < lns.d[center][nodes[b]] })
+	for a := 0; a < lns.params.DestroyNodes && a < len(nodes); a++ {
+		free[nodes[a]] = true
+	}
+	for i := 0; i < len(routes); i++ {
+		for _, j := range routes[i] {
+			if free[j] {
+				vehicles = append(vehicles, i)
+				break
+			}
+		}
+	}
+	if len(vehicles) == 1 && len(routes) > 1 {
+		other := lns.rnd.Intn(len(routes) - 1)
+		if other >= vehicles[0] {
+			other++
+		}
+		vehicles = append(vehicles, other)
+	}
+	sort.Ints(vehicles)
+	return vehicles, free
+}
+
+//repair re-solves the routes of the destroyed vehicles, where the nodes, that are not free, stay with their vehicle.
+//Returns the new routes of all vehicles, or nil if the repair did not find a solution
+func (lns *lnsSolver) repair(routes [][]int, vehicles []int, free []bool) ([][]int, error) {
+	nodes := []int{0}
+	subRoutes := make([][]int, len(vehicles))
+	for v, i := range vehicles {
+		subRoutes[v] = []int{}
+		for _, j := range routes[i] {
+			if j == 0 {
+				continue
+			}
+			if len(subRoutes[v]) == 0 {
+				subRoutes[v] = append(subRoutes[v], 0)
+			}
+			subRoutes[v] = append(subRoutes[v], len(nodes))
+			nodes = append(nodes, j)
+		}
+	}
+	if len(nodes) < 2 {
+		return nil, nil
+	}
+	sub, subD := lns.inst.SubInstance(nodes, vehicles, lns.d)
+	if lns.inst.MaxVehicles > 0 {
+		//the kept routes already use some of the vehicles
+		sub.MaxVehicles = lns.inst.MaxVehicles - UsedVehicles(routes) + UsedVehicles(subRoutes)
+		if sub.MaxVehicles <= 0 {
+			return nil, nil
+		}
+	}
+
+	//the repairs are solved very often, so only errors are logged
+	model, err := createMTSPModel(lns.env, &sub, subD, gurobi.BINARY, lns.params.YType, lns.params.MasterModel, lns.params.SubtourIneq, nil, lns.objective, true)
+	if err != nil {
+		return nil, err
+	}
+	defer model.GModel.Free()
+	for v := 0; v < len(subRoutes); v++ {
+		for _, a := range subRoutes[v] {
+			if a == 0 || free[nodes[a]] {
+				continue
+			}
+			err = model.GModel.AddConstr([]int32{int32(GetNodeIndex(v, a, model.N, model.XStart))}, []float64{1.0}, gurobi.GREATER_EQUAL, 1.0, fmt.Sprintf("LNS_FIX_%d_%d", v, a))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	model.SetInitialSolution(subRoutes)
+	_, err = model.FixVariables()
+	if err != nil {
+		return nil, err
+	}
+	model.GCuts = lns.params.Cuts
+	model.LocalSearch = true
+	err = model.GModel.SetIntParam("OutputFlag", 0)
+	if err != nil {
+		return nil, err
+	}
+	if !lns.deadline.IsZero() {
+		//a single repair of many nodes may take long, so it only gets the remaining time
+		remaining := time.Until(lns.deadline)
+		if remaining <= 0 {
+			return nil, nil
+		}
+		err = model.GModel.SetDblParam(dblParTimeLimit, remaining.Seconds())
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = model.GModel.SetIntParam(gurobi.INT_PAR_LAZYCONSTRAINTS, 1)
+	if err != nil {
+		return nil, err
+	}
+	err = model.GModel.SetCallbackFuncGo(BCHCallbackMTSP, &model)
+	if err != nil {
+		return nil, err
+	}
+	err = model.GModel.Optimize()
+	if err != nil {
+		return nil, err
+	}
+	if model.BestSol.Routes == nil {
+		return nil, nil
+	}
+	repaired := make([][]int, len(routes))
+	copy(repaired, routes)
+	for v, i := range vehicles {
+		repaired[i] = make([]int, len(model.BestSol.Routes[v]))
+		for a, j := range model.BestSol.Routes[v] {
+			repaired[i][a] = nodes[j]
+		}
+	}
+	return repaired, nil
+}
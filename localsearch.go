@@ -0,0 +1,225 @@
+package mtsp
+
+/* Inter-route local search (relocate, swap, cross-exchange, 2-opt*) on the heuristic solutions of the callback. */
+
+//maxSegmentLength bounds the length of the segments exchanged by cross-exchange
+const maxSegmentLength = 3
+
+//lsState holds the routes and their costs during the local search
+type lsState struct {
+	model  *MTSPModel
+	routes [][]int
+	costs  []int
+	obj    int
+	total  int
+}
+
+//ImproveSolution applies the inter-route moves to the routes until none of them improves the objective.
+//Returns the improved routes, their costs and the objective value, or the given ones, if there was no improvement
+func (model *MTSPModel) ImproveSolution(routes [][]int, costs []int) ([][]int, []int, int) {
+	obj := model.objValue(routes, costs)
+	if model.Objective.Prize || model.schedule == nil {
+		//moving nodes between the routes does not change the collected prize
+		return routes, costs, obj
+	}
+	ls := lsState{model: model, routes: make([][]int, len(routes)), costs: make([]int, len(costs)), obj: obj}
+	for i := 0; i < len(routes); i++ {
+		if len(routes[i]) == 0 {
+			ls.routes[i] = []int{0}
+		} else {
+			ls.routes[i] = append([]int{}, routes[i]...)
+		}
+	}
+	copy(ls.costs, costs)
+	ls.total = sumInts(costs)
+	moves := 0
+	for ls.relocate() || ls.swap() || ls.crossExchange() || ls.twoOptStar() {
+		moves++
+	}
+	if moves == 0 || !model.isBetter(ls.obj, obj) {
+		return routes, costs, obj
+	}
+	for i := 0; i < len(ls.routes); i++ {
+		if len(ls.routes[i]) == 1 {
+			ls.routes[i] = []int{}
+		}
+	}
+	Log(3, "The local search improved the heuristic solution from %d to %d with %d moves", obj, ls.obj, moves)
+	return ls.routes, ls.costs, ls.obj
+}
+
+//routeCost returns the cost of vehicle i driving the route and whether the route is feasible
+func (ls *lsState) routeCost(i int, route []int) (int, bool) {
+	if len(route) == 1 {
+		//the vehicle stays at the depot
+		return 0, ls.model.Optional
+	}
+	load := 0
+	for j := 1; j < len(route); j++ {
+		if ls.model.Allowed != nil && !ls.model.Allowed[i][route[j]] {
+			return 0, false
+		}
+		if ls.model.Demands != nil {
+			load += ls.model.Demands[route[j]]
+		}
+	}
+	if ls.model.Demands != nil && load > ls.model.Capacities[i] {
+		return 0, false
+	}
+	length, inTime := ls.model.schedule(i, route, ls.model.EdgeWeights)
+	if !inTime || (ls.model.durationLimit(i) > 0 && length > ls.model.durationLimit(i)) {
+		return 0, false
+	}
+	return length, true
+}
+
+//try replaces the routes of vehicles a and b, if this is feasible and improves the objective
+func (ls *lsState) try(a int, routeA []int, b int, routeB []int) bool {
+	costA, feasible := ls.routeCost(a, routeA)
+	if !feasible {
+		return false
+	}
+	costB, feasible := ls.routeCost(b, routeB)
+	if !feasible {
+		return false
+	}
+	prevA, prevB := ls.costs[a], ls.costs[b]
+	ls.costs[a], ls.costs[b] = costA, costB
+	routes := make([][]int, len(ls.routes))
+	for i := 0; i < len(routes); i++ {
+		routes[i] = ls.routes[i]
+		if len(routes[i]) == 1 {
+			routes[i] = []int{}
+		}
+	}
+	routes[a], routes[b] = routeA, routeB
+	if len(routeA) == 1 {
+		routes[a] = []int{}
+	}
+	if len(routeB) == 1 {
+		routes[b] = []int{}
+	}
+	obj := ls.model.objValue(routes, ls.costs)
+	total := sumInts(ls.costs)
+	improves := ls.model.isBetter(obj, ls.obj) || (obj == ls.obj && total < ls.total)
+	if !improves || !ls.model.isWithinLevels(ls.costs) {
+		ls.costs[a], ls.costs[b] = prevA, prevB
+		return false
+	}
+	ls.routes[a], ls.routes[b] = routeA, routeB
+	ls.obj = obj
+	ls.total = total
+	return true
+}
+
+//sumInts returns the sum of the values
+func sumInts(a []int) int {
+	sum := 0
+	for _, v := range a {
+		sum += v
+	}
+	return sum
+}
+
+//concat returns a new slice with the given parts
+func concat(parts ...[]int) []int {
+	length := 0
+	for _, p := range parts {
+		length += len(p)
+	}
+	res := make([]int, 0, length)
+	for _, p := range parts {
+		res = append(res, p...)
+	}
+	return res
+}
+
+//relocate moves a node of one route to any position of another route
+func (ls *lsState) relocate() bool {
+	for a := 0; a < len(ls.routes); a++ {
+		for b := 0; b < len(ls.routes); b++ {
+			if a == b {
+				continue
+			}
+			ra, rb := ls.routes[a], ls.routes[b]
+			for p := 1; p < len(ra); p++ {
+				newA := concat(ra[:p], ra[p+1:])
+				for q := 1; q <= len(rb); q++ {
+					if ls.try(a, newA, b, concat(rb[:q], []int{ra[p]}, rb[q:])) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+//swap exchanges a node of one route with a node of another route
+func (ls *lsState) swap() bool {
+	for a := 0; a < len(ls.routes); a++ {
+		for b := a + 1; b < len(ls.routes); b++ {
+			ra, rb := ls.routes[a], ls.routes[b]
+			for p := 1; p < len(ra); p++ {
+				for q := 1; q < len(rb); q++ {
+					newA := concat(ra[:p], []int{rb[q]}, ra[p+1:])
+					newB := concat(rb[:q], []int{ra[p]}, rb[q+1:])
+					if ls.try(a, newA, b, newB) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+//crossExchange exchanges a segment of one route with a segment of another route, keeping their orientation
+func (ls *lsState) crossExchange() bool {
+	for a := 0; a < len(ls.routes); a++ {
+		for b := a + 1; b < len(ls.routes); b++ {
+			ra, rb := ls.routes[a], ls.routes[b]
+			for p := 1; p < len(ra); p++ {
+				for q := 1; q < len(rb); q++ {
+					for la := 1; la <= maxSegmentLength && p+la <= len(ra); la++ {
+						for lb := 1; lb <= maxSegmentLength && q+lb <= len(rb); lb++ {
+							if la == 1 && lb == 1 {
+								//already covered by swap
+								continue
+							}
+							newA := concat(ra[:p], rb[q:q+lb], ra[p+la:])
+							newB := concat(rb[:q], ra[p:p+la], rb[q+lb:])
+							if ls.try(a, newA, b, newB) {
+								return true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+//twoOptStar exchanges the tails of two routes after the positions p and q
+func (ls *lsState) twoOptStar() bool {
+	for a := 0; a < len(ls.routes); a++ {
+		for b := a + 1; b < len(ls.routes); b++ {
+			ra, rb := ls.routes[a], ls.routes[b]
+			for p := 1; p <= len(ra); p++ {
+				for q := 1; q <= len(rb); q++ {
+					if (p == len(ra) && q == len(rb)) || (p == 1 && q == 1) {
+						//nothing or everything is exchanged
+						continue
+					}
+					newA := concat(ra[:p], rb[q:])
+					newB := concat(rb[:q], ra[p:])
+					if ls.try(a, newA, b, newB) {
+						return true
+					}
+				}
+			}
+		}
+	}
+	return false
+}
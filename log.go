@@ -35,4 +35,12 @@ func Log(msgLvl int, printF string, args ...interface{}){
 	case 4:
 		logSpam.Printf(printF,args...)
 	}
-}
\ No newline at end of file
+}
+
+//log logs like Log, but a quiet model only logs errors
+func (model *MTSPModel) log(msgLvl int, printF string, args ...interface{}) {
+	if model.Quiet && msgLvl > 1 {
+		return
+	}
+	Log(msgLvl, printF, args...)
+}
@@ -6,6 +6,7 @@ import (
 	"git.solver4all.com/azaryc2s/tsp"
 	"log"
 	"math"
+	"sort"
 )
 
 /*var (
@@ -13,11 +14,6 @@ import (
 	logWarn *log.Logger
 	logErr *log.Logger
 )*/
-var (
-	CutsBendersCount int
-	CutsSECCount     int
-)
-
 /* Given an integer-feasible solution 'sol', find the smallest sub-tour.  Result is returned in 'tour', and length is returned in 'tourlenP'. */
 
 func Findsubtour(edges [][]int) (result []int, isInvalid bool) {
@@ -94,7 +90,7 @@ func LPCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usrd
 			//log.Println(err)
 			Log(1, err.Error())
 		}
-		solA := ExtractEdgeMatrix(sol, N, M, modelData.YStart, modelData.GMastermodel)
+		solA := ExtractEdgeMatrix(sol, N, M, modelData.YStart, modelData.Edges)
 		nodeAss := ExtractNodeMatrix(sol, N, M, modelData.XStart)
 		var subtours [][]int
 		//for each machine, check if there are invalid subtours that do not contain the depot and save those
@@ -134,17 +130,28 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 	N := modelData.N
 	M := modelData.M
 
+	if modelData.Shared != nil {
+		if modelData.Shared.Done() {
+			//another run of the portfolio has proven optimality
+			model.Terminate()
+			return 0
+		}
+		if where == gurobi.CB_MIPNODE {
+			modelData.syncIncumbent()
+		}
+	}
+
 	if where == gurobi.CB_MIPSOL {
 		sol, err := gurobi.CbGetDblArray(cbdata, where, gurobi.CB_MIPSOL_SOL, modelData.VarCount)
 		if err != nil {
 			//log.Println(err)
-			Log(1, err.Error())
+			modelData.log(1, err.Error())
 		}
 
 		objval, err := gurobi.CbGetDbl(cbdata, where, gurobi.CB_MIPSOL_OBJ)
 		if err != nil {
 			//log.Printf("Error retrieving objval: %s\n", os.Args[1])
-			Log(1, "Error retrieving objval: %s", err.Error())
+			modelData.log(1, "Error retrieving objval: %s", err.Error())
 			return 0
 		}
 
@@ -152,13 +159,13 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 		for c := 0; c < len(modelData.GCuts); c++ {
 			cut := modelData.GCuts[c]
 			if cut == CUT_SEC {
-				solA := ExtractEdgeMatrix(sol, N, M, modelData.YStart, modelData.GMastermodel)
+				solA := ExtractEdgeMatrix(sol, N, M, modelData.YStart, modelData.Edges)
 				var subtours [][]int
 				//for each machine, check if there are invalid subtours that do not contain the depot and save those
 				//to derive SECs from them later
 				for i := 0; i < M; i++ {
 					//log.Printf("Looking for subtours in edgeMatrix %d : \n%v\n",i,solA[i])
-					Log(4, "Looking for subtours in edgeMatrix %d : \n%v\n", i, solA[i])
+					modelData.log(4, "Looking for subtours in edgeMatrix %d : \n%v\n", i, solA[i])
 					tour, isTourInvalid := Findsubtour(solA[i])
 					nodeCount := 0
 					for j := 0; j < len(nodeAss[i]); j++ {
@@ -177,15 +184,16 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 						err = gurobi.CbLazy(cbdata, len(secInd[i]), secInd[i], secVal[i], op, rhs[i])
 						if err != nil {
 							//log.Println(err)
-							Log(1, err.Error())
+							modelData.log(1, err.Error())
 						}
 					}
 				}
 			}
 		}
 
-		heurSolObj := 0
+		heurSolCosts := make([]int, M)
 		heurSol := make([][]int, M)
+		heurSolFeasible := true
 		for i := 0; i < M; i++ {
 			indx := make([]int, 0)
 			for n := 0; n < len(nodeAss[i]); n++ {
@@ -193,43 +201,39 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 					indx = append(indx, n)
 				}
 			}
-			d := make([][]int, len(indx))
-			for j := 0; j < len(d); j++ {
-				a := indx[j]
-				d[j] = make([]int, len(indx))
-				for k := 0; k < len(d); k++ {
-					b := indx[k]
-					if j == k {
-						continue
-					}
-					d[j][k] = modelData.EdgeWeights[a][b] * modelData.TravelSpeeds[i]
-				}
+			if len(indx) == 0 {
+				//the vehicle stays at the depot
+				heurSol[i] = []int{}
+				continue
 			}
-
 			var (
 				tour       []int
 				tourLength int
 				subtours   [][]int
+				isFeasible bool
 			)
-			if len(d) == 2 {
-				//there is only 1 node + the depot assigned to this machine, so we dont need to solve the tsp
-				tourLength = d[0][1] + d[1][0]
-				tour = []int{0, 1}
-			} else {
-				tour, tourLength, subtours = tsp.SolveTSP(d, modelData.GEnv)
-				if tour == nil || tourLength < 0 {
-					Log(1, "The tsp for the subproblem was nil...Why?")
-					Log(1, Print2DArray(d))
+			tour, tourLength, subtours, isFeasible, err = modelData.solveSubproblem(i, indx)
+			if err != nil {
+				modelData.log(1, "Error solving the tsptw for the subproblem: %s", err.Error())
+				heurSolFeasible = false
+				continue
+			}
+			if !isFeasible {
+				//no sequence of the assigned nodes meets all time windows, so this assignment is forbidden for the whole vehicle class
+				heurSolFeasible = false
+				for s := 0; s < M; s++ {
+					if modelData.isSameVehicleClass(s, i) {
+						ind, val, op, rhs := getNoGoodFeasibilityCut(modelData, s, indx)
+						err = gurobi.CbLazy(cbdata, len(ind), ind, val, op, rhs)
+						if err != nil {
+							modelData.log(1, err.Error())
+						}
+					}
 				}
-				/*else {
-					log.Printf("TSP-Tour for Machine %d:\n",d)
-					print2DArray(d)
-				}*/
+				continue
 			}
 
-			if heurSolObj < tourLength {
-				heurSolObj = tourLength
-			}
+			heurSolCosts[i] = tourLength
 			//translate machine tour to global indxs
 			for k := 0; k < len(tour); k++ {
 				tour[k] = indx[tour[k]]
@@ -243,9 +247,24 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 
 			heurSol[i] = tour
 
-			Log(3, "\nSolution of the subproblem yielded a tour %v, with length %d!", tour, tourLength)
+			modelData.log(3, "\nSolution of the subproblem yielded a tour %v, with length %d!", tour, tourLength)
+
+			if limit := modelData.durationLimit(i); limit > 0 && tour != nil && tourLength > limit {
+				//the route is longer than allowed, so this assignment is forbidden for all vehicles of the class with at most the same limit
+				modelData.log(3, "The tour of vehicle %d with length %d exceeds its duration limit %d", i, tourLength, limit)
+				for s := 0; s < M; s++ {
+					if modelData.isSameVehicleClass(s, i) && modelData.durationLimit(s) > 0 && modelData.durationLimit(s) <= limit {
+						ind, val, op, rhs := getNoGoodFeasibilityCut(modelData, s, indx)
+						err = gurobi.CbLazy(cbdata, len(ind), ind, val, op, rhs)
+						if err != nil {
+							modelData.log(1, err.Error())
+						}
+					}
+				}
+			}
 
-			if tour != nil && tourLength >= 0 && tourLength > int(objval+0.5) { //since the solution is an integer, we add some float values to avoid numerical errors.
+			routeBound := int(sol[modelData.routeVar(i)] + 0.5)
+			if tour != nil && tourLength >= 0 && tourLength > routeBound { //since the solution is an integer, we add some float values to avoid numerical errors.
 				//log.Printf("Invalid solution found, CMax is %d but must be >= %d. Cutting it off...",int(objval+0.5),tourLength);
 				/*ind, val, op, rhs := getBendersCutV1(modelData,i,modelData.EdgeWeights,tour,tourLength)
 				// Add the benders cut
@@ -253,6 +272,25 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 				if err != nil {
 					log.Println(err)
 				}*/
+				if modelData.TimeWindows != nil {
+					//waiting times make the theta-based cuts invalid, but a route can not get shorter by adding nodes
+					for s := 0; s < M; s++ {
+						if modelData.isSameVehicleClass(s, i) {
+							ind, val, op, rhs := getNoGoodOptimalityCut(modelData, s, tour, tourLength)
+							err = gurobi.CbLazy(cbdata, len(ind), ind, val, op, rhs)
+							if err != nil {
+								modelData.log(1, err.Error())
+							}
+						}
+					}
+					continue
+				}
+				var (
+					misTour   []int
+					misLength int
+					lpCoef    []float64
+					lpFailed  bool
+				)
 				for c := 0; c < len(modelData.GCuts); c++ {
 					cut := modelData.GCuts[c]
 					if cut == CUT_SEC {
@@ -277,11 +315,11 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 								if !hasDepot {
 									filteredSubtours = append(filteredSubtours, subtours[j])
 								} else {
-									Log(4,"SEC for subtour %v from the subproblem will not be included in the Masterproblem (filtered out)",subtours[j])
+									modelData.log(4,"SEC for subtour %v from the subproblem will not be included in the Masterproblem (filtered out)",subtours[j])
 								}
 							}
 							if len(filteredSubtours) < 1 {
-								Log(3, "Supposed to add SECs from the subproblem, but there are none, that do not include the depot!")
+								modelData.log(3, "Supposed to add SECs from the subproblem, but there are none, that do not include the depot!")
 							} else {
 								inds, vals, op, rhs = getSECs(modelData, filteredSubtours, N, M, modelData.YStart)
 							}
@@ -289,14 +327,14 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 								err = gurobi.CbLazy(cbdata, len(inds[j]), inds[j], vals[j], op, rhs[j])
 								if err != nil {
 									//log.Println(err)
-									Log(1, err.Error())
+									modelData.log(1, err.Error())
 								}
 							}
 						*/
 					} else {
-						//also cut it for all other vehicles with the same travel speed
+						//also cut it for all other vehicles with the same travel speed and service times
 						for s := 0; s < len(modelData.TravelSpeeds); s++ {
-							if modelData.TravelSpeeds[s] == modelData.TravelSpeeds[i] {
+							if modelData.isSameVehicleClass(s, i) {
 								var (
 									ind []int32
 									val []float64
@@ -315,6 +353,38 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 									ind, val, op, rhs = getBendersCutV5(modelData, s, tour, tourLength)
 								} else if cut == CUT_BEND_V6 {
 									ind, val, op, rhs = getBendersCutV6(modelData, s, tour, tourLength)
+								} else if cut == CUT_NOGOOD {
+									ind, val, op, rhs = getExactNoGoodCut(modelData, s, tour, tourLength)
+								} else if cut == CUT_NOGOOD_MIS {
+									if misTour == nil {
+										//the reduced set only depends on the vehicle class, so it is computed once
+										misTour, misLength = modelData.minimalNoGoodTour(i, tour, tourLength)
+									}
+									ind, val, op, rhs = getNoGoodOptimalityCut(modelData, s, misTour, misLength)
+								} else if cut == CUT_BEND_LP {
+									if lpCoef == nil && !lpFailed && !modelData.OpenRoutes {
+										//the duals only depend on the vehicle class, so the LP is solved once
+										x := make([]float64, N)
+										for n := 0; n < N; n++ {
+											x[n] = float64(nodeAss[i][n])
+										}
+										lpCoef, err = modelData.lpCutCoefficients(i, x)
+										if err != nil {
+											modelData.log(1, "Error solving the LP subproblem, adding the exact no-good cut instead: %s", err.Error())
+											lpFailed = true
+										}
+									}
+									if lpCoef == nil {
+										//the LP subproblem does not support open routes
+										ind, val, op, rhs = getExactNoGoodCut(modelData, s, tour, tourLength)
+									} else if ind, val, op, rhs = getBendersCutLP(modelData, s, lpCoef); !isCutViolated(sol, ind, val, rhs) {
+										//the LP bound does not reach the tour length, so the no-good cut is added as well to cut off the solution
+										err = gurobi.CbLazy(cbdata, len(ind), ind, val, op, rhs)
+										if err != nil {
+											modelData.log(1, err.Error())
+										}
+										ind, val, op, rhs = getExactNoGoodCut(modelData, s, tour, tourLength)
+									}
 								} else {
 									continue
 								}
@@ -322,7 +392,7 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 								err = gurobi.CbLazy(cbdata, len(ind), ind, val, op, rhs)
 								if err != nil {
 									//log.Println(err)
-									Log(1, err.Error())
+									modelData.log(1, err.Error())
 								}
 							}
 						}
@@ -330,26 +400,63 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 				}
 			} else {
 				//the solution does not invalidate the master solution
-				Log(4, "The Integer-Solution seems to be valid! No Cuts added!")
+				modelData.log(4, "The Integer-Solution seems to be valid! No Cuts added!")
 				continue
 			}
 		}
-		if modelData.BestSol.Obj > heurSolObj {
-			Log(2, "Current best objective was %d, setting it to %d now\n", modelData.BestSol.Obj, heurSolObj)
+		if !heurSolFeasible {
+			modelData.log(3, "The master solution violates some time windows, so there is no heuristic solution")
+			return 0
+		}
+		heurSolObj := modelData.objValue(heurSol, heurSolCosts)
+		for i := 0; i < M; i++ {
+			if limit := modelData.durationLimit(i); limit > 0 && heurSolCosts[i] > limit {
+				modelData.log(3, "The route of vehicle %d in the heuristic solution exceeds its duration limit %d and will be discarded", i, limit)
+				return 0
+			}
+		}
+		if !modelData.isWithinLevels(heurSolCosts) {
+			modelData.log(3, "The heuristic solution exceeds the bounds of the previous balancing levels and will be discarded")
+			return 0
+		}
+		if !modelData.isCompatible(heurSol) {
+			modelData.log(1, "The heuristic solution %v assigns nodes to incompatible vehicles and will be discarded", heurSol)
+			return 0
+		}
+		if !modelData.isLoadFeasible(heurSol) {
+			//the assignment of the master is always within the capacities, but do not trust a solution that is not
+			modelData.log(1, "The heuristic solution %v exceeds the vehicle capacities and will be discarded", heurSol)
+			return 0
+		}
+		if modelData.LocalSearch {
+			//rebalance the routes, before the solution is compared to the best one
+			heurSol, heurSolCosts, heurSolObj = modelData.ImproveSolution(heurSol, heurSolCosts)
+		}
+		modelData.AddToPool(heurSol, heurSolCosts)
+		if modelData.isBetter(heurSolObj, modelData.BestSol.Obj) {
+			modelData.log(2, "Current best objective was %d, setting it to %d now\n", modelData.BestSol.Obj, heurSolObj)
 			modelData.BestSol.Obj = heurSolObj
 			modelData.BestSol.Routes = heurSol
+			modelData.BestSol.RouteCosts = heurSolCosts
+			if modelData.Fixing {
+				//the better bound on the route lengths may exclude further assignments and edges
+				fixVariablesLazy(modelData, cbdata)
+			}
+			if modelData.Shared != nil {
+				modelData.Shared.Offer(heurSolObj, heurSol, heurSolCosts, modelData.Name)
+			}
 
 			if int(objval+0.5) == heurSolObj {
 				//The current master-solution has the same objval as the calculated sequences from TSP, so the value has been used already before we get the chance to set the solution!
 				modelData.NewBestSol = false
-			} else if int(objval+0.5) > 0 && int(objval+0.5) < heurSolObj {
+			} else if int(objval+0.5) > 0 && modelData.isBetter(int(objval+0.5), heurSolObj) {
 				//The heuristic solution is worse than the current objval, which means we added some benders cuts
-				Log(2, "Found new best solution with value %d, while the master solution was invalid", heurSolObj)
+				modelData.log(2, "Found new best solution with value %d, while the master solution was invalid", heurSolObj)
 
 				modelData.NewBestSol = true
 			} else {
 				//The heuristic solution was better, than the master solution (this can happen??) HOW come??
-				Log(2, "Found new best solution with value %d, which is even better than the current master solution!", heurSolObj)
+				modelData.log(2, "Found new best solution with value %d, which is even better than the current master solution!", heurSolObj)
 				modelData.NewBestSol = true
 			}
 		}
@@ -359,32 +466,63 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 		if modelData.NewBestSol {
 			objbst, err := gurobi.CbGetDbl(cbdata, where, gurobi.CB_MIPNODE_OBJBST)
 			if err != nil {
-				Log(1, "Couldn't retrieve the obj_best in the callback: %s\n", err.Error())
+				modelData.log(1, "Couldn't retrieve the obj_best in the callback: %s\n", err.Error())
 				return 0
 			}
-			if int(objbst+0.5) > 0 && int(objbst+0.5) <= modelData.BestSol.Obj {
-				Log(2, "Current obj %d is already better than the heuristic solution %d . Skipping...\n", int(objbst+0.5), modelData.BestSol.Obj)
+			if int(objbst+0.5) > 0 && !modelData.isBetter(modelData.BestSol.Obj, int(objbst+0.5)) {
+				modelData.log(2, "Current obj %d is already better than the heuristic solution %d . Skipping...\n", int(objbst+0.5), modelData.BestSol.Obj)
 				modelData.NewBestSol = false
 				return 0
 			}
-			Log(2, "Currently setting new heuristic solution with obj-value %d replacing the current bestobj %d \n", modelData.BestSol.Obj, int(objbst+0.5))
+			modelData.log(2, "Currently setting new heuristic solution with obj-value %d replacing the current bestobj %d \n", modelData.BestSol.Obj, int(objbst+0.5))
 			solution := make([]float64, modelData.VarCount)
 
 			//set the objective
-			solution[modelData.CMax] = float64(modelData.BestSol.Obj)
+			for i := 0; i < len(modelData.BestSol.RouteCosts); i++ {
+				if solution[modelData.CMax] < float64(modelData.BestSol.RouteCosts[i]) {
+					solution[modelData.CMax] = float64(modelData.BestSol.RouteCosts[i])
+				}
+				if modelData.RCount > 0 {
+					solution[modelData.RStart+i] = float64(modelData.BestSol.RouteCosts[i])
+				}
+			}
+			if modelData.BCount > 0 {
+				//u_t is the t+1 longest route and p_ti the amount route i exceeds it
+				sorted := sortedDesc(modelData.BestSol.RouteCosts)
+				for t := 0; t <= len(modelData.Objective.Levels); t++ {
+					ut := modelData.BStart + t*(M+1)
+					solution[ut] = float64(sorted[t])
+					for i := 0; i < M; i++ {
+						solution[ut+1+i] = math.Max(float64(modelData.BestSol.RouteCosts[i]-sorted[t]), 0.0)
+					}
+				}
+			}
 
 			//set X and Y-Variables
 			sX := ""
 			sY := ""
+			hasMissingEdges := false
 			for i := 0; i < len(modelData.BestSol.Routes); i++ {
+				if len(modelData.BestSol.Routes[i]) == 0 {
+					continue
+				}
 				prev := 0
 				for j := 0; j < len(modelData.BestSol.Routes[i]); j++ {
 					act := modelData.BestSol.Routes[i][j]
 					solution[GetNodeIndex(i, act, N, modelData.XStart)] = 1.0
 					sX += fmt.Sprintf("%s = %d, ", modelData.VarNames[GetNodeIndex(i, act, N, modelData.XStart)], 1)
-					if prev != 0 || act != 0 {
-						solution[GetEdgeIndex(i, prev, act, N, modelData.YStart, modelData.GMastermodel)] = 1.0
-						sY += fmt.Sprintf("%s = %d, ", modelData.VarNames[GetEdgeIndex(i, prev, act, N, modelData.YStart, modelData.GMastermodel)], 1)
+					if (prev != 0 || act != 0) && modelData.EdgeIndex(i, prev, act) < 0 {
+						hasMissingEdges = true
+					} else if prev != 0 || act != 0 {
+						solution[modelData.EdgeIndex(i, prev, act)] = 1.0
+						sY += fmt.Sprintf("%s = %d, ", modelData.VarNames[modelData.EdgeIndex(i, prev, act)], 1)
+						if modelData.CCount > 0 {
+							solution[modelData.CStart+act] = solution[modelData.CStart+prev] + float64(modelData.EdgeWeights[prev][act]*modelData.TravelSpeeds[i])
+						}
+						if modelData.FCount > 0 {
+							//the edge carries one unit for each of the remaining nodes
+							solution[modelData.FEdges.EdgeIndex(i, prev, act, modelData.FStart)] = float64(len(modelData.BestSol.Routes[i]) - j)
+						}
 					}
 					prev = act
 				}
@@ -392,22 +530,35 @@ func BCHCallbackMTSP(model *gurobi.Model, cbdata gurobi.CPVoid, where int32, usr
 				if modelData.GMastermodel != MASTERMODEL_ATSP && len(modelData.BestSol.Routes[i]) == 2 {
 					v = 2.0
 				}
-				solution[GetEdgeIndex(i, prev, 0, N, modelData.YStart, modelData.GMastermodel)] = v
-				sY += fmt.Sprintf("%s = %d, ", modelData.VarNames[GetEdgeIndex(i, prev, 0, N, modelData.YStart, modelData.GMastermodel)], int(v))
+				if modelData.EdgeIndex(i, prev, 0) < 0 {
+					hasMissingEdges = true
+				} else {
+					solution[modelData.EdgeIndex(i, prev, 0)] = v
+					sY += fmt.Sprintf("%s = %d, ", modelData.VarNames[modelData.EdgeIndex(i, prev, 0)], int(v))
+				}
+				if modelData.LCount > 0 {
+					//the edge back to the depot is the one not driven
+					solution[GetNodeIndex(i, prev, N, modelData.LStart)] = 1.0
+				}
+			}
+			if hasMissingEdges {
+				modelData.log(3, "The heuristic solution uses edges outside of the candidate graph and can not be set")
+				modelData.NewBestSol = false
+				return 0
 			}
 			//set the solution
 			val, err := gurobi.CbSolution(cbdata, solution)
 
 			//check the error and objv
 			if err != nil {
-				Log(1, "Couldn't set the heuristic solution: %s\n", err.Error())
+				modelData.log(1, "Couldn't set the heuristic solution: %s\n", err.Error())
 			} else {
 				modelData.NewBestSol = false
 				if int(val) > 0 {
-					Log(2, "New best solution with value : %d set!\n", int(val))
+					modelData.log(2, "New best solution with value : %d set!\n", int(val))
 				} else {
-					Log(1, "Something went wrong when setting the solution!")
-					Log(1, "We tried to set routes: \n%s", Print2DArray(modelData.BestSol.Routes))
+					modelData.log(1, "Something went wrong when setting the solution!")
+					modelData.log(1, "We tried to set routes: \n%s", Print2DArray(modelData.BestSol.Routes))
 				}
 			}
 		}
@@ -433,7 +584,11 @@ func getSECs(model *MTSPModel, subtours [][]int, N int, M int, start int) (secIn
 					if k == j {
 						continue
 					}
-					ind = append(ind, int32(GetEdgeIndex(i, stour[j], stour[k], N, model.YStart, model.GMastermodel)))
+					ei := model.EdgeIndex(i, stour[j], stour[k])
+					if ei < 0 {
+						continue
+					}
+					ind = append(ind, int32(ei))
 					val = append(val, 1.0)
 
 
@@ -443,8 +598,8 @@ func getSECs(model *MTSPModel, subtours [][]int, N int, M int, start int) (secIn
 				val = append(val, -1.0)
 			}
 		}
-		CutsSECCount++
-		Log(3, "Adding SEC nr.%d for subtour: %v", CutsSECCount, stour)
+		model.CutsSECCount++
+		Log(3, "Adding SEC nr.%d for subtour: %v", model.CutsSECCount, stour)
 		secInd = append(secInd, ind)
 		secVal = append(secVal, val)
 		//TODO: trying SECs based on selected nodes
@@ -454,6 +609,9 @@ func getSECs(model *MTSPModel, subtours [][]int, N int, M int, start int) (secIn
 	return secInd, secVal, gurobi.LESS_EQUAL, rhs
 }
 
+//The thetas bound how much shorter the tour gets without node j. With open routes the last node only saves the edge to its predecessor,
+//which is covered by the longest edge in all thetas, so the cuts keep their properties.
+
 //These must be valid, can't imagine it would cutoff any feasible solutions...
 func getBendersCutV1(model *MTSPModel, i int, tour []int, tourLength int) (ind []int32, val []float64, op int8, rhs float64) {
 	thetaSum := 0
@@ -476,21 +634,21 @@ func getBendersCutV1(model *MTSPModel, i int, tour []int, tourLength int) (ind [
 			}
 		}
 		Log(4, "Longest edge from %d is to %d with %d", tour[j], tour[maxK], max)
-		theta := max * 2 //2x the distance to the furthest node in the same assignment
+		theta := max*2 + model.ServiceTimes[i][tour[j]] //2x the distance to the furthest node in the same assignment
 		thetaSum += theta
 		ind = append(ind, int32(GetNodeIndex(i, tour[j], model.N, model.XStart)))
 		val = append(val, float64(-theta))
 	}
-	ind = append(ind, int32(model.CMax))
+	ind = append(ind, int32(model.routeVar(i)))
 	val = append(val, 1.0)
 
-	bCut := fmt.Sprintf("Cmax")
+	bCut := model.VarNames[model.routeVar(i)]
 	for vn := 0; vn < len(ind)-1; vn++ {
 		bCut += fmt.Sprintf(" %d*%s", int(val[vn]), model.VarNames[ind[vn]])
 	}
 	bCut += fmt.Sprintf(" >= %d - %d", tourLength, thetaSum)
-	CutsBendersCount++
-	Log(3, "Adding benders cut V1 nr.%d:\n%s\n", CutsBendersCount, bCut)
+	model.CutsBendersCount++
+	Log(3, "Adding benders cut V1 nr.%d:\n%s\n", model.CutsBendersCount, bCut)
 	return ind, val, gurobi.GREATER_EQUAL, float64(tourLength - thetaSum)
 }
 
@@ -509,21 +667,21 @@ func getBendersCutV2(model *MTSPModel, i int, tour []int, tourLength int) (ind [
 				max = edge
 			}
 		}
-		theta := max + model.EdgeWeights[tour[j]][tour[0]] * model.TravelSpeeds[i]
+		theta := max + model.EdgeWeights[tour[j]][tour[0]] * model.TravelSpeeds[i] + model.ServiceTimes[i][tour[j]]
 		thetaSum += theta
 		ind = append(ind, int32(GetNodeIndex(i, tour[j], model.N, model.XStart)))
 		val = append(val, float64(-theta))
 	}
-	ind = append(ind, int32(model.CMax))
+	ind = append(ind, int32(model.routeVar(i)))
 	val = append(val, 1.0)
 
-	bCut := fmt.Sprintf("Cmax")
+	bCut := model.VarNames[model.routeVar(i)]
 	for vn := 0; vn < len(ind)-1; vn++ {
 		bCut += fmt.Sprintf(" %d*%s", int(val[vn]), model.VarNames[ind[vn]])
 	}
 	bCut += fmt.Sprintf(" >= %d - %d", tourLength, thetaSum)
-	CutsBendersCount++
-	Log(3, "Adding benders cut V4 nr.%d:\n%s\n", CutsBendersCount, bCut)
+	model.CutsBendersCount++
+	Log(3, "Adding benders cut V4 nr.%d:\n%s\n", model.CutsBendersCount, bCut)
 	return ind, val, gurobi.GREATER_EQUAL, float64(tourLength - thetaSum)
 }
 
@@ -546,21 +704,21 @@ func getBendersCutV3(model *MTSPModel, i int, tour []int, tourLength int) (ind [
 				max = edge
 			}
 		}
-		theta := min + max
+		theta := min + max + model.ServiceTimes[i][tour[j]]
 		thetaSum += theta
 		ind = append(ind, int32(GetNodeIndex(i, tour[j], model.N, model.XStart)))
 		val = append(val, float64(-theta))
 	}
-	ind = append(ind, int32(model.CMax))
+	ind = append(ind, int32(model.routeVar(i)))
 	val = append(val, 1.0)
 
-	bCut := fmt.Sprintf("Cmax")
+	bCut := model.VarNames[model.routeVar(i)]
 	for vn := 0; vn < len(ind)-1; vn++ {
 		bCut += fmt.Sprintf(" %d*%s", int(val[vn]), model.VarNames[ind[vn]])
 	}
 	bCut += fmt.Sprintf(" >= %d - %d", tourLength, thetaSum)
-	CutsBendersCount++
-	Log(3, "Adding benders cut V2 nr.%d:\n%s\n", CutsBendersCount, bCut)
+	model.CutsBendersCount++
+	Log(3, "Adding benders cut V2 nr.%d:\n%s\n", model.CutsBendersCount, bCut)
 	return ind, val, gurobi.GREATER_EQUAL, float64(tourLength - thetaSum)
 }
 
@@ -594,22 +752,22 @@ func getBendersCutV4(model *MTSPModel, i int, tour []int, tourLength int) (ind [
 				maxPre = edge
 			}
 		}
-		theta := nodeDur[j] + maxPre
+		theta := nodeDur[j] + maxPre + model.ServiceTimes[i][tour[j]]
 		//theta := model.pp[tour[j]] + maxPre
 		thetaSum += theta
 		ind = append(ind, int32(GetNodeIndex(i, tour[j], model.N, model.XStart)))
 		val = append(val, float64(-theta))
 	}
-	ind = append(ind, int32(model.CMax))
+	ind = append(ind, int32(model.routeVar(i)))
 	val = append(val, 1.0)
 
-	bCut := fmt.Sprintf("Cmax")
+	bCut := model.VarNames[model.routeVar(i)]
 	for vn := 0; vn < len(ind)-1; vn++ {
 		bCut += fmt.Sprintf(" %d*%s", int(val[vn]), model.VarNames[ind[vn]])
 	}
 	bCut += fmt.Sprintf(" >= %d - %d", tourLength, thetaSum)
-	CutsBendersCount++
-	Log(3, "Adding benders cut V3 nr.%d:\n%s\n", CutsBendersCount, bCut)
+	model.CutsBendersCount++
+	Log(3, "Adding benders cut V3 nr.%d:\n%s\n", model.CutsBendersCount, bCut)
 	return ind, val, gurobi.GREATER_EQUAL, float64(tourLength - thetaSum)
 }
 
@@ -629,21 +787,21 @@ func getBendersCutV5(model *MTSPModel, i int, tour []int, tourLength int) (ind [
 				max = edge
 			}
 		}
-		theta := max
+		theta := max + model.ServiceTimes[i][tour[j]]
 		thetaSum += theta
 		ind = append(ind, int32(GetNodeIndex(i, tour[j], model.N, model.XStart)))
 		val = append(val, float64(-theta))
 	}
-	ind = append(ind, int32(model.CMax))
+	ind = append(ind, int32(model.routeVar(i)))
 	val = append(val, 1.0)
 
-	bCut := fmt.Sprintf("Cmax")
+	bCut := model.VarNames[model.routeVar(i)]
 	for vn := 0; vn < len(ind)-1; vn++ {
 		bCut += fmt.Sprintf(" %d*%s", int(val[vn]), model.VarNames[ind[vn]])
 	}
 	bCut += fmt.Sprintf(" >= %d - %d", tourLength, thetaSum)
-	CutsBendersCount++
-	Log(3, "Adding benders cut V4 nr.%d:\n%s\n", CutsBendersCount, bCut)
+	model.CutsBendersCount++
+	Log(3, "Adding benders cut V4 nr.%d:\n%s\n", model.CutsBendersCount, bCut)
 	return ind, val, gurobi.GREATER_EQUAL, float64(tourLength - thetaSum)
 }
 
@@ -653,24 +811,253 @@ func getBendersCutV6(model *MTSPModel, i int, tour []int, tourLength int) (ind [
 	for j := 1; j < len(tour); j++ {
 		prev := j - 1
 		next := (j + 1) % len(tour)
-		theta := model.EdgeWeights[tour[prev]][tour[j]] + model.EdgeWeights[tour[j]][tour[next]] + model.EdgeWeights[tour[prev]][tour[next]]
+		theta := model.EdgeWeights[tour[prev]][tour[j]] + model.EdgeWeights[tour[j]][tour[next]] + model.EdgeWeights[tour[prev]][tour[next]] + model.ServiceTimes[i][tour[j]]
 		thetaSum += theta
 		ind = append(ind, int32(GetNodeIndex(i, tour[j], model.N, model.XStart)))
 		val = append(val, float64(-theta))
 	}
-	ind = append(ind, int32(model.CMax))
+	ind = append(ind, int32(model.routeVar(i)))
 	val = append(val, 1.0)
 
-	bCut := fmt.Sprintf("Cmax")
+	bCut := model.VarNames[model.routeVar(i)]
 	for vn := 0; vn < len(ind)-1; vn++ {
 		bCut += fmt.Sprintf(" %d*%s", int(val[vn]), model.VarNames[ind[vn]])
 	}
 	bCut += fmt.Sprintf(" >= %d - %d", tourLength, thetaSum)
-	CutsBendersCount++
-	Log(3, "Adding benders cut V4 nr.%d:\n%s\n", CutsBendersCount, bCut)
+	model.CutsBendersCount++
+	Log(3, "Adding benders cut V4 nr.%d:\n%s\n", model.CutsBendersCount, bCut)
 	return ind, val, gurobi.GREATER_EQUAL, float64(tourLength - thetaSum)
 }
 
+//EdgeIndex returns the index of the variable of edge (j,k) of vehicle i, or -1 if the edge is not in the candidate graph
+func (model *MTSPModel) EdgeIndex(i, j, k int) int {
+	return model.Edges.EdgeIndex(i, j, k, model.YStart)
+}
+
+//routeVar returns the index of the variable bounding the route cost of vehicle i, which is Cmax unless the model has route cost variables
+func (model *MTSPModel) routeVar(i int) int {
+	if model.RCount > 0 {
+		return model.RStart + i
+	}
+	return model.CMax
+}
+
+//solveSubproblem sequences the nodes indx (including the depot) assigned to vehicle i. The returned tour and subtours refer to the positions in indx.
+//isFeasible is false, if no sequence meets the time windows
+func (model *MTSPModel) solveSubproblem(i int, indx []int) (tour []int, tourLength int, subtours [][]int, isFeasible bool, err error) {
+	d := make([][]int, len(indx))
+	for j := 0; j < len(d); j++ {
+		a := indx[j]
+		d[j] = make([]int, len(indx))
+		for k := 0; k < len(d); k++ {
+			b := indx[k]
+			if j == k {
+				continue
+			}
+			d[j][k] = model.EdgeWeights[a][b] * model.TravelSpeeds[i]
+		}
+	}
+
+	if model.TimeWindows != nil {
+		//the sequence matters for the time windows, so the service times are part of the subproblem
+		st := make([]int, len(indx))
+		tw := make([][]int, len(indx))
+		for j := 0; j < len(indx); j++ {
+			st[j] = model.ServiceTimes[i][indx[j]]
+			tw[j] = model.TimeWindows[indx[j]]
+		}
+		td := d
+		if model.OpenRoutes {
+			td = openRouteMatrix(d)
+		}
+		tour, tourLength, isFeasible, err = SolveTSPTW(td, st, tw, model.GEnv)
+		return tour, tourLength, nil, isFeasible, err
+	} else if len(d) == 2 {
+		//there is only 1 node + the depot assigned to this machine, so we dont need to solve the tsp
+		tourLength = d[0][1]
+		if !model.OpenRoutes {
+			tourLength += d[1][0]
+		}
+		tour = []int{0, 1}
+	} else if model.OpenRoutes {
+		tour, tourLength = SolveOpenTSP(d, model.GEnv)
+		if tour == nil || tourLength < 0 {
+			Log(1, "The hamiltonian path for the subproblem was nil...Why?")
+			Log(1, Print2DArray(d))
+		}
+	} else {
+		tour, tourLength, subtours = tsp.SolveTSP(d, model.GEnv)
+		if tour == nil || tourLength < 0 {
+			Log(1, "The tsp for the subproblem was nil...Why?")
+			Log(1, Print2DArray(d))
+		}
+	}
+
+	if tour != nil && tourLength >= 0 {
+		//the service times do not depend on the sequence, so they are simply added to the tsp length
+		for n := 0; n < len(indx); n++ {
+			tourLength += model.ServiceTimes[i][indx[n]]
+		}
+	}
+	return tour, tourLength, subtours, true, nil
+}
+
+//durationLimit returns the maximal length of the route of vehicle i, which is the smaller one of the upper bound on Cmax
+//and the duration limit of the vehicle. 0 means that the route length is not limited
+func (model *MTSPModel) durationLimit(i int) int {
+	limit := model.CMaxUB
+	if model.MaxDurations != nil && model.MaxDurations[i] > 0 && (limit <= 0 || model.MaxDurations[i] < limit) {
+		limit = model.MaxDurations[i]
+	}
+	return limit
+}
+
+//objValue returns the objective value of a solution with the given routes and route costs
+func (model *MTSPModel) objValue(routes [][]int, routeCosts []int) int {
+	sorted := sortedDesc(routeCosts)
+	if model.Objective.Levels != nil {
+		sum := 0
+		for t := 0; t <= len(model.Objective.Levels) && t < len(sorted); t++ {
+			sum += sorted[t]
+		}
+		return sum
+	}
+	fixedCosts := 0
+	for i := 0; i < len(routes) && model.FixedCosts != nil; i++ {
+		if len(routes[i]) > 0 {
+			fixedCosts += model.FixedCosts[i]
+		}
+	}
+	if model.Objective.Prize {
+		prize := 0
+		for i := 0; i < len(routes); i++ {
+			for j := 0; j < len(routes[i]); j++ {
+				prize += model.Prices[routes[i][j]]
+			}
+		}
+		return prize - fixedCosts
+	}
+	total := 0
+	for i := 0; i < len(sorted); i++ {
+		total += sorted[i]
+	}
+	max := 0
+	if len(sorted) > 0 {
+		max = sorted[0]
+	}
+	return model.Objective.WCMax*max + model.Objective.WTotal*total + fixedCosts
+}
+
+//isBetter reports whether the objective value a is strictly better than b
+func (model *MTSPModel) isBetter(a, b int) bool {
+	if model.Objective.Prize {
+		return a > b
+	}
+	return a < b
+}
+
+//isWithinLevels reports whether the sums of the longest route costs respect the bounds of the previous balancing levels
+func (model *MTSPModel) isWithinLevels(routeCosts []int) bool {
+	sorted := sortedDesc(routeCosts)
+	sum := 0
+	for t := 0; t < len(model.Objective.Levels) && t < len(sorted); t++ {
+		sum += sorted[t]
+		if sum > model.Objective.Levels[t] {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedDesc(a []int) []int {
+	sorted := make([]int, len(a))
+	copy(sorted, a)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	return sorted
+}
+
+//isSameVehicleClass reports whether vehicles a and b have the same travel speed and service times,
+//so that a subproblem solved for one of them is also valid for the other
+func (model *MTSPModel) isSameVehicleClass(a, b int) bool {
+	if model.TravelSpeeds[a] != model.TravelSpeeds[b] {
+		return false
+	}
+	for j := 0; j < model.N; j++ {
+		if model.ServiceTimes[a][j] != model.ServiceTimes[b][j] {
+			return false
+		}
+	}
+	return true
+}
+
+//isLoadFeasible reports whether none of the routes exceeds the capacity of its vehicle
+func (model *MTSPModel) isLoadFeasible(routes [][]int) bool {
+	if model.Demands == nil {
+		return true
+	}
+	for i := 0; i < len(routes); i++ {
+		load := 0
+		for j := 0; j < len(routes[i]); j++ {
+			load += model.Demands[routes[i][j]]
+		}
+		if load > model.Capacities[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//Forbids vehicle i to serve exactly the given nodes or a superset of them: sum_{j in S}(X_ij) <= |S|-1
+func getNoGoodFeasibilityCut(model *MTSPModel, i int, nodes []int) (ind []int32, val []float64, op int8, rhs float64) {
+	count := 0
+	for j := 0; j < len(nodes); j++ {
+		if nodes[j] == 0 {
+			continue
+		}
+		ind = append(ind, int32(GetNodeIndex(i, nodes[j], model.N, model.XStart)))
+		val = append(val, 1.0)
+		count++
+	}
+	model.CutsFeasibilityCount++
+	Log(3, "Adding no-good feasibility cut nr.%d for vehicle %d and nodes %v", model.CutsFeasibilityCount, i, nodes)
+	return ind, val, gurobi.LESS_EQUAL, float64(count - 1)
+}
+
+//If vehicle i serves all nodes of the tour, its route takes at least tourLength: Cmax >= tourLength - tourLength*sum_{j in S}(1-X_ij)
+//(or R_i instead of Cmax, if the route costs are part of the objective)
+//Valid as long as adding nodes to a route never makes it shorter (triangle inequality)
+func getNoGoodOptimalityCut(model *MTSPModel, i int, tour []int, tourLength int) (ind []int32, val []float64, op int8, rhs float64) {
+	count := 0
+	for j := 0; j < len(tour); j++ {
+		if tour[j] == 0 {
+			continue
+		}
+		ind = append(ind, int32(GetNodeIndex(i, tour[j], model.N, model.XStart)))
+		val = append(val, float64(-tourLength))
+		count++
+	}
+	ind = append(ind, int32(model.routeVar(i)))
+	val = append(val, 1.0)
+	model.CutsBendersCount++
+	Log(3, "Adding no-good optimality cut nr.%d: %s >= %d for vehicle %d serving %v", model.CutsBendersCount, model.VarNames[model.routeVar(i)], tourLength, i, tour)
+	return ind, val, gurobi.GREATER_EQUAL, float64(tourLength - tourLength*count)
+}
+
+//isCompatible reports whether every node of the routes may be served by its vehicle
+func (model *MTSPModel) isCompatible(routes [][]int) bool {
+	if model.Allowed == nil {
+		return true
+	}
+	for i := 0; i < len(routes); i++ {
+		for j := 0; j < len(routes[i]); j++ {
+			if !model.Allowed[i][routes[i][j]] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func ExtractNodeMatrix(solA []float64, N int, M int, xStart int) [][]int {
 	xMat := make([][]int, M)
 	for i := 0; i < M; i++ {
@@ -686,7 +1073,7 @@ func ExtractNodeMatrix(solA []float64, N int, M int, xStart int) [][]int {
 	return xMat
 }
 
-func ExtractEdgeMatrix(solA []float64, N int, M int, yStart int, model string) [][][]int {
+func ExtractEdgeMatrix(solA []float64, N int, M int, yStart int, edges EdgeSet) [][][]int {
 	yMat := make([][][]int, M)
 	for i := 0; i < M; i++ {
 		yMat[i] = make([][]int, N)
@@ -695,10 +1082,10 @@ func ExtractEdgeMatrix(solA []float64, N int, M int, yStart int, model string) [
 		}
 		for j := 0; j < N; j++ {
 			for k := 0; k < N; k++ {
-				if k == j {
+				if k == j || !edges.Has(j, k) {
 					continue
 				}
-				if solA[GetEdgeIndex(i, j, k, N, yStart, model)] > 0.95 {
+				if solA[edges.EdgeIndex(i, j, k, yStart)] > 0.95 {
 					yMat[i][j][k] = 1
 				}
 			}
@@ -707,27 +1094,57 @@ func ExtractEdgeMatrix(solA []float64, N int, M int, yStart int, model string) [
 	return yMat
 }
 
-func CheckSolutionValidity(routes [][]int, d [][]int, s []int, obj int) (bool,string) {
+func CheckSolutionValidity(inst *MTSPInstance, routes [][]int, d [][]int, obj int) (bool,string) {
 	valid := true
 	comment := ""
+	if inst.MaxVehicles > 0 && UsedVehicles(routes) > inst.MaxVehicles {
+		comment += fmt.Sprintf("The solution uses %d vehicles but only %d are allowed! ", UsedVehicles(routes), inst.MaxVehicles)
+		valid = false
+	}
 	for i := 0; i < len(routes); i++ {
-		routeLength := 0
-		for j := 0; j < len(routes[i]); j++ {
-			k := (j + 1) % len(routes[i])
-			routeLength += d[routes[i][j]][routes[i][k]] * s[i]
+		routeLength, inTime := inst.RouteSchedule(i, routes[i], d)
+		if !inTime {
+			comment += fmt.Sprintf("Route %d violates some time windows! ", i)
+			valid = false
 		}
 		if routeLength > obj {
-			comment = fmt.Sprintf("The computed solution is too long! Is %d but can only be %d!", routeLength, obj)
+			comment += fmt.Sprintf("The computed solution is too long! Is %d but can only be %d! ", routeLength, obj)
 			valid = false
 		}
+		if inst.MaxDuration(i) > 0 && routeLength > inst.MaxDuration(i) {
+			comment += fmt.Sprintf("Route %d exceeds the duration limit! Is %d but can only be %d! ", i, routeLength, inst.MaxDuration(i))
+			valid = false
+		}
+		for j := 0; j < len(routes[i]); j++ {
+			if !inst.IsAllowed(i, routes[i][j]) {
+				comment += fmt.Sprintf("Vehicle %d is not allowed to serve node %d! ", i, routes[i][j])
+				valid = false
+			}
+		}
+		if inst.IsCapacitated() {
+			load := inst.RouteLoad(routes[i])
+			if load > inst.Capacities[i] {
+				comment += fmt.Sprintf("Route %d exceeds the capacity! Load is %d but can only be %d! ", i, load, inst.Capacities[i])
+				valid = false
+			}
+		}
 	}
 	return valid,comment
 }
 
-func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yType int8, masterModel string, subtourIneq string) (MTSPModel, error) {
+func CreateMTSPModel(gurobiEnv *gurobi.Env, inst *MTSPInstance, d [][]int, xType int8, yType int8, masterModel string, subtourIneq string, candidates [][]bool, objective MTSPObjective) (MTSPModel, error) {
+	return createMTSPModel(gurobiEnv, inst, d, xType, yType, masterModel, subtourIneq, candidates, objective, false)
+}
+
+//createMTSPModel creates the model like CreateMTSPModel. A quiet model only logs errors, also while it is created
+func createMTSPModel(gurobiEnv *gurobi.Env, inst *MTSPInstance, d [][]int, xType int8, yType int8, masterModel string, subtourIneq string, candidates [][]bool, objective MTSPObjective, quiet bool) (MTSPModel, error) {
+	logf := func(msgLvl int, printF string, args ...interface{}) {
+		if !quiet || msgLvl <= 1 {
+			Log(msgLvl, printF, args...)
+		}
+	}
 	var err error
-	CutsSECCount = 0
-	CutsBendersCount = 0
+	s := inst.TravelSpeeds
 	if gurobiEnv == nil {
 		//create the gurobi environment */
 		gurobiEnv, err = gurobi.LoadEnv("mtsp_gurobi.log")
@@ -736,33 +1153,76 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 		defer gurobiEnv.SetIntParam("LogToConsole", int32(1))
 	}
 	addSubtourIneq := false
-	if masterModel == MASTERMODEL_ATSP && subtourIneq == SUBTOURINEQ_MTZ {
-		addSubtourIneq = true
+	addFlowIneq := false
+	if subtourIneq == SUBTOURINEQ_MTZ {
+		if masterModel == MASTERMODEL_ATSP {
+			addSubtourIneq = true
+		} else {
+			logf(1, "The MTZ constraints need the directed edges of the %s master model and will not be added", MASTERMODEL_ATSP)
+		}
+	} else if subtourIneq == SUBTOURINEQ_SCF || subtourIneq == SUBTOURINEQ_GG {
+		addFlowIneq = true
 	}
 
 	N := len(d)
 	M := len(s)
-	xCount := M * N //X_ij
-	yCount := 0
-	if masterModel == MASTERMODEL_ATSP {
-		yCount = M * (N * (N - 1))
-	} else {
-		yCount = M * (((N * N) - N) / 2) //Y_ijk
+	st := inst.ServiceTimeMatrix(N)
+	//when collecting prizes the vehicles do not have to leave the depot either
+	optional := inst.HasOptionalVehicles() || objective.Prize
+	//with open routes the asymmetric model just drives back to the depot for free,
+	//the symmetric one has to choose the depot edge, that is not driven, with the variables L_ik
+	cd := d
+	if inst.OpenRoutes && masterModel == MASTERMODEL_ATSP {
+		cd = openRouteMatrix(d)
 	}
+	lCount := 0
+	if inst.OpenRoutes && masterModel != MASTERMODEL_ATSP {
+		lCount = M * N
+	}
+	xCount := M * N //X_ij
+	//the edges Y_ijk of the candidate graph, which are all edges if there are no candidates
+	edges := NewEdgeSet(N, masterModel == MASTERMODEL_ATSP, candidates)
+	yCount := M * edges.Count
 	cCount := 0
 	if addSubtourIneq {
 		cCount = N
 	}
-	varCount := 1 + xCount + yCount + cCount //all variables
+	//the flow formulations send one unit of flow from the depot to each node over the directed edges F_ijk, in both master models
+	fEdges := NewEdgeSet(N, true, candidates)
+	fCount := 0
+	if addFlowIneq {
+		fCount = M * fEdges.Count
+	}
+	//if the total cost is part of the objective, the routes are balanced or limited in their duration, each route gets its own cost variable R_i
+	rCount := 0
+	if objective.WTotal != 0 || objective.Levels != nil || inst.MaxDurations != nil {
+		rCount = M
+	}
+	//balancing the routes up to level k needs the variables u_t and p_ti for t < k, with the sum of the t+1 longest routes being (t+1)*u_t + sum_i(p_ti)
+	bCount := 0
+	if objective.Levels != nil {
+		bCount = (len(objective.Levels) + 1) * (M + 1)
+	}
+	varCount := 1 + xCount + yCount + cCount + fCount + lCount + rCount + bCount //all variables
 
 	CMax := 0
 	xStart := CMax + 1
 	yStart := xStart + xCount
 	cStart := yStart + yCount
+	fStart := cStart + cCount
+	lStart := fStart + fCount
+	rStart := lStart + lCount
+	bStart := rStart + rCount
 
 	varType := make([]int8, varCount)
 
-	varType[CMax] = gurobi.INTEGER
+	//with continuous assignments the whole model is relaxed to its LP
+	intType := gurobi.INTEGER
+	if xType == gurobi.CONTINUOUS {
+		intType = gurobi.CONTINUOUS
+	}
+
+	varType[CMax] = intType
 
 	for i := xStart; i < xStart+xCount; i++ {
 		varType[i] = xType
@@ -774,7 +1234,23 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 	}
 
 	for i := cStart; i < cStart+cCount; i++ {
-		varType[i] = gurobi.INTEGER
+		varType[i] = intType
+	}
+
+	for i := fStart; i < fStart+fCount; i++ {
+		varType[i] = gurobi.CONTINUOUS
+	}
+
+	for i := lStart; i < lStart+lCount; i++ {
+		varType[i] = gurobi.CONTINUOUS
+	}
+
+	for i := rStart; i < rStart+rCount; i++ {
+		varType[i] = intType
+	}
+
+	for i := bStart; i < bStart+bCount; i++ {
+		varType[i] = gurobi.CONTINUOUS
 	}
 
 	varNames := make([]string, varCount)
@@ -790,7 +1266,7 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 		for j := 0; j < N; j++ {
 			if masterModel == MASTERMODEL_ATSP {
 				for k := 0; k < N; k++ {
-					if k == j {
+					if k == j || !edges.Has(j, k) {
 						continue
 					}
 					varNames[counter] = fmt.Sprintf("Y_%d_%d_%d", i, j, k)
@@ -798,10 +1274,13 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 				}
 			} else {
 				for k := j + 1; k < N; k++ {
+					if !edges.Has(j, k) {
+						continue
+					}
 					//Allow the edge variables from the depot to be integers (also have the value 2),
 					////so that tours with only 1 node are also possible. Otherwise those will be forbidden
 					if j == 0 && yType == gurobi.BINARY{
-						edgeIndex := GetEdgeIndex(i,j,k,N,yStart,masterModel)
+						edgeIndex := edges.EdgeIndex(i,j,k,yStart)
 						varType[edgeIndex] = gurobi.INTEGER
 					}
 					varNames[counter] = fmt.Sprintf("Y_%d_%d_%d", i, j, k)
@@ -811,32 +1290,125 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 		}
 	}
 	if addSubtourIneq {
+		for j := 0; j < N; j++ {
+			varNames[counter] = fmt.Sprintf("C_%d", j)
+			counter++
+		}
+	}
+	for i := 0; i < M && fCount > 0; i++ {
+		for j := 0; j < N; j++ {
+			for k := 0; k < N; k++ {
+				if k == j || !fEdges.Has(j, k) {
+					continue
+				}
+				varNames[counter] = fmt.Sprintf("F_%d_%d_%d", i, j, k)
+				counter++
+			}
+		}
+	}
+	for i := 0; i < M && lCount > 0; i++ {
+		for j := 0; j < N; j++ {
+			varNames[counter] = fmt.Sprintf("L_%d_%d", i, j)
+			counter++
+		}
+	}
+	for i := 0; i < rCount; i++ {
+		varNames[counter] = fmt.Sprintf("R_%d", i)
+		counter++
+	}
+	for t := 0; t < bCount/(M+1); t++ {
+		varNames[counter] = fmt.Sprintf("U_%d", t)
+		counter++
 		for i := 0; i < M; i++ {
-			varNames[counter] = fmt.Sprintf("C_%d", i)
+			varNames[counter] = fmt.Sprintf("P_%d_%d", t, i)
 			counter++
 		}
 	}
 
 	objFun := make([]float64, varCount)
-	objFun[CMax] = 1.0
+	objFun[CMax] = float64(objective.WCMax)
 	for i := 1; i < len(objFun); i++ {
 		objFun[i] = 0.0 //need this because of some random values otherwise
 	}
+	if objective.Prize {
+		objFun[CMax] = 0.0
+		for i := 0; i < M; i++ {
+			for j := 1; j < N; j++ {
+				if objective.PrizeWeights != nil {
+					objFun[GetNodeIndex(i, j, N, xStart)] = objective.PrizeWeights[j]
+				} else {
+					objFun[GetNodeIndex(i, j, N, xStart)] = float64(inst.Prices[j])
+				}
+			}
+		}
+	} else if objective.Levels != nil {
+		objFun[CMax] = 0.0
+		k := len(objective.Levels)
+		ut := bStart + k*(M+1)
+		objFun[ut] = float64(k + 1)
+		for i := 0; i < M; i++ {
+			objFun[ut+1+i] = 1.0
+		}
+	} else {
+		for i := rStart; i < rStart+rCount; i++ {
+			objFun[i] = float64(objective.WTotal)
+		}
+	}
+	if objective.Levels == nil && inst.FixedCosts != nil {
+		//using a vehicle costs its fixed costs, which reduce the collected prize
+		for i := 0; i < M; i++ {
+			if objective.Prize {
+				objFun[GetNodeIndex(i, 0, N, xStart)] = float64(-inst.FixedCosts[i])
+			} else {
+				objFun[GetNodeIndex(i, 0, N, xStart)] = float64(inst.FixedCosts[i])
+			}
+		}
+	}
 	// Create model
 	model, err := gurobiEnv.NewModel("mtsp", int32(varCount), objFun, nil, nil, varType, varNames)
 	if err != nil {
-		Log(1, err.Error())
+		logf(1, err.Error())
 		return MTSPModel{}, err
 	}
 	//defer model.Free()
 
-	// Change objective sense to minimization
-	err = model.SetIntAttr(gurobi.INT_ATTR_MODELSENSE, gurobi.MINIMIZE)
+	// Change objective sense to minimization, or maximization for the collected prize
+	sense := int32(gurobi.MINIMIZE)
+	if objective.Prize {
+		sense = int32(gurobi.MAXIMIZE)
+	}
+	err = model.SetIntAttr(gurobi.INT_ATTR_MODELSENSE, sense)
 	if err != nil {
-		Log(1, err.Error())
+		logf(1, err.Error())
 		return MTSPModel{}, err
 	}
 
+	cMaxUB := 0
+	if objective.Prize {
+		//Add constraint Cmax <= tmax limiting the duration of all routes
+		cMaxUB = inst.TMax
+		err = model.AddConstr([]int32{int32(CMax)}, []float64{1.0}, gurobi.LESS_EQUAL, float64(inst.TMax), "TMAX")
+		if err != nil {
+			logf(1, "Error adding constraint Cmax <= tmax with error: %s\n", err.Error())
+			return MTSPModel{}, err
+		}
+	}
+
+	if inst.MaxDurations != nil {
+		//Add constraints R_i <= maxDuration_i limiting the duration of each route
+		logf(2, "Creating and setting constraints R_i <= maxDuration_i")
+		for i := 0; i < M; i++ {
+			if inst.MaxDurations[i] <= 0 {
+				continue
+			}
+			err = model.AddConstr([]int32{int32(rStart + i)}, []float64{1.0}, gurobi.LESS_EQUAL, float64(inst.MaxDurations[i]), fmt.Sprintf("DUR_%d", i))
+			if err != nil {
+				logf(1, "Error adding constraint R_%d <= %d with error: %s\n", i, inst.MaxDurations[i], err.Error())
+				return MTSPModel{}, err
+			}
+		}
+	}
+
 	var pp []int
 	var ps [][]int
 	//TODO: trying out pseudo setup-times and pseudo-process times
@@ -850,7 +1422,7 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 				if k == j {
 					continue
 				}
-				edge := d[j][k]
+				edge := cd[j][k]
 				if min < 0 || edge < min {
 					min = edge
 				}
@@ -864,14 +1436,14 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 					ps[j][k] = 0
 					continue
 				}
-				ps[j][k] = d[j][k] - pp[j]
+				ps[j][k] = cd[j][k] - pp[j]
 			}
 		}
 	}
 
 	//Add constraints (2) linking to CMax
 	{
-		Log(2, "Creating and setting constraints <= CMax (2)")
+		logf(2, "Creating and setting constraints <= CMax (2)")
 		for i := 0; i < M; i++ {
 			ind := make([]int32, 0)
 			val := make([]float64, 0)
@@ -879,39 +1451,69 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 				if masterModel == MASTERMODEL_ATSP {
 					//TODO: trying out pseudo setup-times and pseudo-process times
 					ni := GetNodeIndex(i, j, N, xStart)
-					Log(4, "Adding %d*X_{%d %d} at var index %d with name %s", pp[j]*s[i], i, j, ni, varNames[ni])
+					logf(4, "Adding %d*X_{%d %d} at var index %d with name %s", pp[j]*s[i]+st[i][j], i, j, ni, varNames[ni])
 					ind = append(ind, int32(ni))
-					val = append(val, float64(pp[j]*s[i]))
+					val = append(val, float64(pp[j]*s[i]+st[i][j]))
 					for k := 0; k < N; k++ {
-						if k == j {
+						ei := edges.EdgeIndex(i, j, k, yStart)
+						if k == j || ei < 0 {
 							continue
 						}
-						ei := GetEdgeIndex(i, j, k, N, yStart, masterModel)
-						Log(4, "Adding %d*Y_{%d %d %d} at var index %d with name %s", ps[j][k]*s[i], i, j, k, ei, varNames[ei])
+						logf(4, "Adding %d*Y_{%d %d %d} at var index %d with name %s", ps[j][k]*s[i], i, j, k, ei, varNames[ei])
 						ind = append(ind, int32(ei))
 						val = append(val, float64(ps[j][k]*s[i]))
 					}
 				} else {
+					if st[i][j] > 0 {
+						ind = append(ind, int32(GetNodeIndex(i, j, N, xStart)))
+						val = append(val, float64(st[i][j]))
+					}
 					for k := j + 1; k < N; k++ {
-						ind = append(ind, int32(GetEdgeIndex(i, j, k, N, yStart, masterModel)))
+						if !edges.Has(j, k) {
+							continue
+						}
+						ind = append(ind, int32(edges.EdgeIndex(i, j, k, yStart)))
 						val = append(val, float64(d[j][k]*s[i]))
 					}
 				}
 			}
-			ind = append(ind, int32(CMax))
-			val = append(val, -1.0)
+			if lCount > 0 {
+				for k := 1; k < N; k++ {
+					ind = append(ind, int32(GetNodeIndex(i, k, N, lStart)))
+					val = append(val, float64(-d[0][k]*s[i]))
+				}
+			}
+			if rCount > 0 {
+				//the route cost is bounded by R_i, which in turn is bounded by CMax
+				ind = append(ind, int32(rStart+i))
+				val = append(val, -1.0)
+				rInd := []int32{int32(rStart + i), int32(CMax)}
+				rVal := []float64{1.0, -1.0}
+				err = model.AddConstr(rInd, rVal, gurobi.LESS_EQUAL, 0.0, fmt.Sprintf("2R_%d", i))
+				if err != nil {
+					logf(1, "Error adding constraint R_%d <= CMax with error: %s\n", i, err.Error())
+					return MTSPModel{}, err
+				}
+			} else {
+				ind = append(ind, int32(CMax))
+				val = append(val, -1.0)
+			}
 
 			err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, 0.0, fmt.Sprintf("2_%d", i))
 			if err != nil {
-				Log(1, "Error adding constraint (2) at i=%d with error: %s\n", i, err.Error())
+				logf(1, "Error adding constraint (2) at i=%d with error: %s\n", i, err.Error())
 				return MTSPModel{}, err
 			}
 		}
 	}
 
-	//Add constraints (3) ensuring each node is only visited by exactly one vehicle
+	//Add constraints (3) ensuring each node is only visited by exactly one vehicle, or at most one when collecting prizes
 	{
-		Log(2, "Creating and setting constraints sum_i(Xij) = 1 (3)") //(2)
+		logf(2, "Creating and setting constraints sum_i(Xij) = 1 (3)") //(2)
+		op := int8(gurobi.EQUAL)
+		if objective.Prize {
+			op = int8(gurobi.LESS_EQUAL)
+		}
 		for j := 1; j < N; j++ {
 			ind := make([]int32, 0)
 			val := make([]float64, 0)
@@ -920,17 +1522,86 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 				val = append(val, 1.0)
 			}
 
-			err = model.AddConstr(ind, val, gurobi.EQUAL, 1.0, fmt.Sprintf("3_%d", j))
+			err = model.AddConstr(ind, val, op, 1.0, fmt.Sprintf("3_%d", j))
 			if err != nil {
-				Log(1, "Error adding constraint (3) at j=%d with error: %s\n", j, err.Error())
+				logf(1, "Error adding constraint (3) at j=%d with error: %s\n", j, err.Error())
 				return MTSPModel{}, err
 			}
 		}
 	}
 
-	//Add constraints (4) ensuring each vehicle starts at the depot
-	{
-		Log(2, "Creating and setting constraints Xi0 = 1 (4)") //(4)
+	if inst.IsCapacitated() {
+		//Add knapsack constraints ensuring the demand assigned to each vehicle does not exceed its capacity
+		logf(2, "Creating and setting capacity constraints sum_j(q_j*Xij) <= Q_i")
+		for i := 0; i < M; i++ {
+			ind := make([]int32, 0)
+			val := make([]float64, 0)
+			for j := 1; j < N; j++ {
+				if inst.Demands[j] == 0 {
+					continue
+				}
+				ind = append(ind, int32(GetNodeIndex(i, j, N, xStart)))
+				val = append(val, float64(inst.Demands[j]))
+			}
+			err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, float64(inst.Capacities[i]), fmt.Sprintf("CAP_%d", i))
+			if err != nil {
+				logf(1, "Error adding capacity constraint at i=%d with error: %s\n", i, err.Error())
+				return MTSPModel{}, err
+			}
+		}
+	}
+
+	allowed := inst.AllowedMatrix(N)
+	if allowed != nil {
+		//Fix the assignments of nodes to vehicles, that are not allowed to serve them
+		logf(2, "Fixing Xij = 0 for incompatible vehicles and nodes")
+		for i := 0; i < M; i++ {
+			for j := 1; j < N; j++ {
+				if allowed[i][j] {
+					continue
+				}
+				ind := []int32{int32(GetNodeIndex(i, j, N, xStart))}
+				val := []float64{1.0}
+				err = model.AddConstr(ind, val, gurobi.EQUAL, 0.0, fmt.Sprintf("COMP_%d_%d", i, j))
+				if err != nil {
+					logf(1, "Error fixing X_%d_%d with error: %s\n", i, j, err.Error())
+					return MTSPModel{}, err
+				}
+			}
+		}
+	}
+
+	if optional {
+		//Add constraints (4) ensuring only vehicles leaving the depot serve nodes
+		logf(2, "Creating and setting constraints Xij <= Xi0 (4)")
+		for i := 0; i < M; i++ {
+			for j := 1; j < N; j++ {
+				ind := []int32{int32(GetNodeIndex(i, j, N, xStart)), int32(GetNodeIndex(i, 0, N, xStart))}
+				val := []float64{1.0, -1.0}
+				err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, 0.0, fmt.Sprintf("4_%d_%d", i, j))
+				if err != nil {
+					logf(1, "Error adding constraint (4) at i=%d,j=%d with error: %s\n", i, j, err.Error())
+					return MTSPModel{}, err
+				}
+			}
+		}
+		if inst.MaxVehicles > 0 {
+			logf(2, "Creating and setting constraint sum_i(Xi0) <= %d", inst.MaxVehicles)
+			ind := make([]int32, 0)
+			val := make([]float64, 0)
+			for i := 0; i < M; i++ {
+				ind = append(ind, int32(GetNodeIndex(i, 0, N, xStart)))
+				val = append(val, 1.0)
+			}
+			err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, float64(inst.MaxVehicles), "VEH_MAX")
+			if err != nil {
+				logf(1, "Error adding the limit of active vehicles with error: %s\n", err.Error())
+				return MTSPModel{}, err
+			}
+		}
+	} else {
+		//Add constraints (4) ensuring each vehicle starts at the depot
+		logf(2, "Creating and setting constraints Xi0 = 1 (4)") //(4)
 		for i := 0; i < M; i++ {
 			ind := make([]int32, 1)
 			val := make([]float64, 1)
@@ -940,7 +1611,7 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 
 			err = model.AddConstr(ind, val, gurobi.EQUAL, 1.0, fmt.Sprintf("4_%d", i))
 			if err != nil {
-				Log(1, "Error adding constraint (4) at i=%d with error: %s\n", i, err.Error())
+				logf(1, "Error adding constraint (4) at i=%d with error: %s\n", i, err.Error())
 				return MTSPModel{}, err
 			}
 		}
@@ -948,7 +1619,7 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 
 	if masterModel == MASTERMODEL_ATSP {
 		//Add constraints (5.1)  and (5.2) for the asymmetric version ensuring the incoming flow is 1 and the outgoing also 1
-		Log(2, "Creating and setting constraints (5.1) Xij = sum_k(Yikj) and (5.2) Xij = sum_k(Yijk)")
+		logf(2, "Creating and setting constraints (5.1) Xij = sum_k(Yikj) and (5.2) Xij = sum_k(Yijk)")
 		for i := 0; i < M; i++ {
 			for j := 0; j < N; j++ {
 				ind := make([]int32, 0)
@@ -956,18 +1627,18 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 				ind = append(ind, int32(GetNodeIndex(i, j, N, xStart)))
 				val = append(val, -1.0)
 				for k := 0; k < N; k++ {
-					if k == j {
+					ei := edges.EdgeIndex(i, k, j, yStart)
+					if k == j || ei < 0 {
 						continue
 					}
-					ei := GetEdgeIndex(i, k, j, N, yStart, masterModel)
-					Log(4, "Adding Y_{%d %d %d} at var index %d with name %s", i, k, j, ei, varNames[ei])
+					logf(4, "Adding Y_{%d %d %d} at var index %d with name %s", i, k, j, ei, varNames[ei])
 					ind = append(ind, int32(ei))
 					val = append(val, 1.0)
 				}
-				Log(3, "Adding sum_k(Y_{%d k %d}) = X_{%d %d} with name 5.1_%d_%d", i, j, i, j, i, j)
+				logf(3, "Adding sum_k(Y_{%d k %d}) = X_{%d %d} with name 5.1_%d_%d", i, j, i, j, i, j)
 				err = model.AddConstr(ind, val, gurobi.EQUAL, 0.0, fmt.Sprintf("5.1_%d_%d", i, j))
 				if err != nil {
-					Log(1, "Error adding constraint (5.1) at i=%d,j=%d: %s\n", i, j, err.Error())
+					logf(1, "Error adding constraint (5.1) at i=%d,j=%d: %s\n", i, j, err.Error())
 					return MTSPModel{}, err
 				}
 
@@ -976,35 +1647,35 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 				ind = append(ind, int32(GetNodeIndex(i, j, N, xStart)))
 				val = append(val, -1.0)
 				for k := 0; k < N; k++ {
-					if k == j {
+					ei := edges.EdgeIndex(i, j, k, yStart)
+					if k == j || ei < 0 {
 						continue
 					}
-					ei := GetEdgeIndex(i, j, k, N, yStart, masterModel)
-					Log(4, "Adding Y_{%d %d %d} at var index %d with name %s", i, j, k, ei, varNames[ei])
+					logf(4, "Adding Y_{%d %d %d} at var index %d with name %s", i, j, k, ei, varNames[ei])
 					ind = append(ind, int32(ei))
 					val = append(val, 1.0)
 				}
-				Log(3, "Adding sum_k(Y_{%d %d k}) = X_{%d %d} with name 5.2_%d_%d", i, j, i, j, i, j)
+				logf(3, "Adding sum_k(Y_{%d %d k}) = X_{%d %d} with name 5.2_%d_%d", i, j, i, j, i, j)
 				err = model.AddConstr(ind, val, gurobi.EQUAL, 0.0, fmt.Sprintf("5.2_%d_%d", i, j))
 				if err != nil {
-					Log(1, "Error adding constraint (5.2) at i=%d,j=%d: %s\n", i, j, err.Error())
+					logf(1, "Error adding constraint (5.2) at i=%d,j=%d: %s\n", i, j, err.Error())
 					return MTSPModel{}, err
 				}
 			}
 		}
 	} else {
 		//Add constraints (5) for the symmetric version
-		Log(2, "Creating and setting constraints 2Xij = sum_k(Yikj) + sum_k(Yijk) (5)")
+		logf(2, "Creating and setting constraints 2Xij = sum_k(Yikj) + sum_k(Yijk) (5)")
 		for i := 0; i < M; i++ {
 			for j := 0; j < N; j++ {
 				ind := make([]int32, 0)
 				val := make([]float64, 0)
 				for k := 0; k < N; k++ {
-					if k == j {
+					ei := edges.EdgeIndex(i, j, k, yStart)
+					if k == j || ei < 0 {
 						continue
 					}
-					ei := GetEdgeIndex(i, j, k, N, yStart, masterModel)
-					Log(3, "Adding Y_{%d %d %d} at var index %d with name %s", i, j, k, ei, varNames[ei])
+					logf(3, "Adding Y_{%d %d %d} at var index %d with name %s", i, j, k, ei, varNames[ei])
 					ind = append(ind, int32(ei)) //this method flips j and k on its own if needed
 					val = append(val, 1.0)
 				}
@@ -1013,7 +1684,7 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 
 				err = model.AddConstr(ind, val, gurobi.EQUAL, 0.0, fmt.Sprintf("5_%d_%d", i, j))
 				if err != nil {
-					Log(1, "Error adding constraint (5) at i=%d,j=%d: %s\n", i, j, err.Error())
+					logf(1, "Error adding constraint (5) at i=%d,j=%d: %s\n", i, j, err.Error())
 					return MTSPModel{}, err
 				}
 			}
@@ -1022,7 +1693,7 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 
 
 	{
-		Log(2, "Adding Global SEC per vehicle based on node assignments")
+		logf(2, "Adding Global SEC per vehicle based on node assignments")
 		for i := 0; i < M; i++ {
 			var (
 				ind []int32
@@ -1031,7 +1702,10 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 			for j := 1; j < N; j++ {
 				st := j + 1
 				for k := st; k < N; k++ {
-					ind = append(ind, int32(GetEdgeIndex(i, j, k, N, yStart, masterModel)))
+					if !edges.Has(j, k) {
+						continue
+					}
+					ind = append(ind, int32(edges.EdgeIndex(i, j, k, yStart)))
 					val = append(val, 1.0)
 
 				}
@@ -1040,9 +1714,83 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 				val = append(val, -1.0)
 			}
 			//TODO: trying SECs based on selected nodes??
-			err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, -1.0, fmt.Sprintf("SEC_global_%d",i))
+			rhs := -1.0
+			if optional {
+				//only a vehicle leaving the depot has to serve a node
+				ind = append(ind, int32(GetNodeIndex(i, 0, N, xStart)))
+				val = append(val, 1.0)
+				rhs = 0.0
+			}
+			err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, rhs, fmt.Sprintf("SEC_global_%d",i))
+			if err != nil {
+				logf(1, "Error adding global SEC for vehicle %d with error: %s\n", i, err.Error())
+				return MTSPModel{}, err
+			}
+		}
+	}
+
+	if bCount > 0 {
+		//Add constraints p_ti >= R_i - u_t and bound the sums of the longest routes by the previous balancing levels
+		logf(2, "Creating and setting balancing constraints p_ti >= R_i - u_t and (t+1)*u_t + sum_i(p_ti) <= level_t")
+		for t := 0; t <= len(objective.Levels); t++ {
+			ut := bStart + t*(M+1)
+			for i := 0; i < M; i++ {
+				ind := []int32{int32(ut + 1 + i), int32(rStart + i), int32(ut)}
+				val := []float64{1.0, -1.0, 1.0}
+				err = model.AddConstr(ind, val, gurobi.GREATER_EQUAL, 0.0, fmt.Sprintf("BAL_%d_%d", t, i))
+				if err != nil {
+					logf(1, "Error adding balancing constraint at t=%d,i=%d: %s\n", t, i, err.Error())
+					return MTSPModel{}, err
+				}
+			}
+			if t == len(objective.Levels) {
+				continue
+			}
+			ind := []int32{int32(ut)}
+			val := []float64{float64(t + 1)}
+			for i := 0; i < M; i++ {
+				ind = append(ind, int32(ut+1+i))
+				val = append(val, 1.0)
+			}
+			err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, float64(objective.Levels[t]), fmt.Sprintf("BAL_%d", t))
+			if err != nil {
+				logf(1, "Error adding balancing level constraint at t=%d: %s\n", t, err.Error())
+				return MTSPModel{}, err
+			}
+		}
+	}
+
+	if lCount > 0 {
+		//Add constraints L_ik <= Y_i0k and sum_k(L_ik) = Xi0 choosing the last node of each open route
+		logf(2, "Creating and setting constraints for the last nodes of the open routes L_ik <= Y_i0k, sum_k(L_ik) = Xi0")
+		for i := 0; i < M; i++ {
+			ind := make([]int32, 0)
+			val := make([]float64, 0)
+			for k := 1; k < N; k++ {
+				li := GetNodeIndex(i, k, N, lStart)
+				ind = append(ind, int32(li))
+				val = append(val, 1.0)
+				lInd := []int32{int32(li)}
+				lVal := []float64{1.0}
+				if edges.Has(0, k) {
+					lInd = append(lInd, int32(edges.EdgeIndex(i, 0, k, yStart)))
+					lVal = append(lVal, -1.0)
+				}
+				err = model.AddConstr(lInd, lVal, gurobi.LESS_EQUAL, 0.0, fmt.Sprintf("L_%d_%d", i, k))
+				if err != nil {
+					logf(1, "Error adding last node constraint at i=%d,k=%d: %s\n", i, k, err.Error())
+					return MTSPModel{}, err
+				}
+			}
+			rhs := 1.0
+			if optional {
+				ind = append(ind, int32(GetNodeIndex(i, 0, N, xStart)))
+				val = append(val, -1.0)
+				rhs = 0.0
+			}
+			err = model.AddConstr(ind, val, gurobi.EQUAL, rhs, fmt.Sprintf("L_%d", i))
 			if err != nil {
-				Log(1, "Error adding global SEC for vehicle %d with error: %s\n", i, err.Error())
+				logf(1, "Error adding last node constraint at i=%d: %s\n", i, err.Error())
 				return MTSPModel{}, err
 			}
 		}
@@ -1050,23 +1798,38 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 
 	if addSubtourIneq {
 		//Add constraints (6) as MTZ
-		Log(2, "Creating and setting MTZ constraints C_k - C_j + V(1-Y_ijk) >= c_jk*s_i (6)")
+		logf(2, "Creating and setting MTZ constraints C_k - C_j + V(1-Y_ijk) >= c_jk*s_i (6)")
 		//log.Println("Creating and setting MTZ constraints C_k - C_j + V(1-Y_ijk) >= c_jk*s_i (6)") //(6)
 		{
 			ind := []int32{int32(cStart)}
 			val := []float64{1.0}
 			err = model.AddConstr(ind, val, gurobi.EQUAL, 0, fmt.Sprintf("6_%d", 0))
 			if err != nil {
-				Log(1, "Error adding MTZ-constraint for depot: %s", err.Error())
+				logf(1, "Error adding MTZ-constraint for depot: %s", err.Error())
 				return MTSPModel{}, err
 			}
 		}
-		V := 65000.0
+		//C_j is the arrival time at node j, which is bounded by the longest hamiltonian path of the slowest vehicle
+		V := 0.0
+		for i := 0; i < M; i++ {
+			path := 0
+			for j := 0; j < N; j++ {
+				max := 0
+				for k := 0; k < N; k++ {
+					if d[j][k] > max {
+						max = d[j][k]
+					}
+				}
+				path += max * s[i]
+			}
+			V = math.Max(V, float64(path))
+		}
+		logf(3, "Using V = %.0f in the MTZ constraints", V)
 		count := 1
 		for i := 0; i < M; i++ {
 			for j := 0; j < N; j++ {
 				for k := 1; k < N; k++ {
-					if k == j {
+					if k == j || !edges.Has(j, k) {
 						continue
 					}
 					ind := make([]int32, 3)
@@ -1075,20 +1838,99 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 					val[0] = 1.0
 					ind[1] = int32(cStart + j)
 					val[1] = -1.0
-					ind[2] = int32(GetEdgeIndex(i, j, k, N, yStart, masterModel))
-					val[2] = V * -1.0
+					ind[2] = int32(edges.EdgeIndex(i, j, k, yStart))
+					bigM := V + float64(d[j][k]*s[i])
+					val[2] = bigM * -1.0
 
-					err = model.AddConstr(ind, val, gurobi.GREATER_EQUAL, float64(d[j][k]*s[i])-V, fmt.Sprintf("6_%d", count))
+					err = model.AddConstr(ind, val, gurobi.GREATER_EQUAL, float64(d[j][k]*s[i])-bigM, fmt.Sprintf("6_%d", count))
 					if err != nil {
-						Log(1, "Error adding MTZ constraint at i=%d, j=%d, k=%d: %s\n", i, j, k, err.Error())
+						logf(1, "Error adding MTZ constraint at i=%d, j=%d, k=%d: %s\n", i, j, k, err.Error())
 						return MTSPModel{}, err
 					}
 					count++
 				}
 			}
 		}
+	} else if addFlowIneq {
+		//Add the flow constraints sum_k(F_i0k) = sum_j(X_ij) and sum_k(F_ikj) - sum_k(F_ijk) = X_ij, so each node served by vehicle i consumes one unit
+		logf(2, "Creating and setting %s flow constraints", subtourIneq)
+		for i := 0; i < M; i++ {
+			for j := 0; j < N; j++ {
+				ind := make([]int32, 0)
+				val := make([]float64, 0)
+				for k := 0; k < N; k++ {
+					if k == j || !fEdges.Has(j, k) {
+						continue
+					}
+					if j > 0 {
+						ind = append(ind, int32(fEdges.EdgeIndex(i, k, j, fStart)))
+						val = append(val, 1.0)
+					}
+					ind = append(ind, int32(fEdges.EdgeIndex(i, j, k, fStart)))
+					val = append(val, -1.0)
+				}
+				if j > 0 {
+					ind = append(ind, int32(GetNodeIndex(i, j, N, xStart)))
+					val = append(val, -1.0)
+				} else {
+					for k := 1; k < N; k++ {
+						ind = append(ind, int32(GetNodeIndex(i, k, N, xStart)))
+						val = append(val, 1.0)
+					}
+				}
+				err = model.AddConstr(ind, val, gurobi.EQUAL, 0.0, fmt.Sprintf("FLOW_%d_%d", i, j))
+				if err != nil {
+					logf(1, "Error adding flow constraint at i=%d, j=%d: %s\n", i, j, err.Error())
+					return MTSPModel{}, err
+				}
+			}
+		}
+		//Add the coupling constraints F_ijk <= (N-1)Y_ijk, in the symmetric model F_ijk + F_ikj <= (N-1)Y_ijk.
+		//GG tightens them to F_ijk <= (N-2)Y_ijk for edges not leaving the depot and adds Y_ijk <= F_ijk for edges between the nodes,
+		//since such an edge carries at least the unit of its head
+		logf(2, "Creating and setting %s coupling constraints", subtourIneq)
+		for i := 0; i < M; i++ {
+			for j := 0; j < N; j++ {
+				for k := 0; k < N; k++ {
+					if k == j || (masterModel != MASTERMODEL_ATSP && k < j) || !edges.Has(j, k) {
+						continue
+					}
+					ei := edges.EdgeIndex(i, j, k, yStart)
+					fInd := []int32{int32(fEdges.EdgeIndex(i, j, k, fStart))}
+					if masterModel != MASTERMODEL_ATSP {
+						fInd = append(fInd, int32(fEdges.EdgeIndex(i, k, j, fStart)))
+					}
+					capacity := float64(N - 1)
+					if subtourIneq == SUBTOURINEQ_GG && j > 0 {
+						capacity = float64(N - 2)
+					}
+					ind := append([]int32{int32(ei)}, fInd...)
+					val := []float64{-capacity}
+					for l := 1; l < len(ind); l++ {
+						val = append(val, 1.0)
+					}
+					err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, 0.0, fmt.Sprintf("FCAP_%d_%d_%d", i, j, k))
+					if err != nil {
+						logf(1, "Error adding flow coupling constraint at i=%d, j=%d, k=%d: %s\n", i, j, k, err.Error())
+						return MTSPModel{}, err
+					}
+					if subtourIneq != SUBTOURINEQ_GG || j == 0 || k == 0 {
+						continue
+					}
+					val = []float64{1.0}
+					for l := 1; l < len(ind); l++ {
+						val = append(val, -1.0)
+					}
+					err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, 0.0, fmt.Sprintf("FMIN_%d_%d_%d", i, j, k))
+					if err != nil {
+						logf(1, "Error adding flow coupling constraint at i=%d, j=%d, k=%d: %s\n", i, j, k, err.Error())
+						return MTSPModel{}, err
+					}
+				}
+			}
+		}
 	} else {
-		Log(2, "No subtour inequalitie classes will be added to the master-problem!")
+		logf(2, "No subtour inequalitie classes will be added to the master-problem!")
 	}
 
 	// Must set LazyConstraints parameter when using lazy constraints
@@ -1099,7 +1941,18 @@ func CreateMTSPModel(gurobiEnv *gurobi.Env, d [][]int, s []int, xType int8, yTyp
 		return MTSPModel{}, err
 	}
 
-	mtspModel := MTSPModel{GModel: model, GEnv: gurobiEnv, GMastermodel: masterModel, BestSol: MTSPSolution{Obj: math.MaxInt32}, NewBestSol: false, EdgeWeights: d, TravelSpeeds: s, pp: pp, ps: ps, N: N, M: M, VarNames: varNames, CMax: CMax, XStart: xStart, YStart: yStart, XCount: xCount, YCount: yCount, VarCount: varCount}
+	var demands, capacities []int
+	if inst.IsCapacitated() {
+		demands = inst.Demands
+		capacities = inst.Capacities
+	}
+	bestObj := math.MaxInt32
+	if objective.Prize {
+		bestObj = -1
+	}
+	mtspModel := MTSPModel{GModel: model, GEnv: gurobiEnv, GMastermodel: masterModel, BestSol: MTSPSolution{Obj: bestObj}, NewBestSol: false, EdgeWeights: d, TravelSpeeds: s, ServiceTimes: st, Demands: demands, Capacities: capacities, TimeWindows: inst.TimeWindows, Prices: inst.Prices, Allowed: allowed, OpenRoutes: inst.OpenRoutes, Optional: optional, FixedCosts: inst.FixedCosts, MaxDurations: inst.MaxDurations, pp: pp, ps: ps, N: N, M: M, VarNames: varNames, CMax: CMax, XStart: xStart, YStart: yStart, XCount: xCount, YCount: yCount, Edges: edges, FEdges: fEdges, CStart: cStart, CCount: cCount, FStart: fStart, FCount: fCount, LStart: lStart, LCount: lCount, RStart: rStart, RCount: rCount, BStart: bStart, BCount: bCount, Objective: objective, CMaxUB: cMaxUB, VarCount: varCount}
+	mtspModel.Quiet = quiet
+	mtspModel.schedule = func(i int, route []int, d [][]int) (int, bool) { return inst.RouteSchedule(i, route, d) }
 
 	return mtspModel, nil
 }
@@ -0,0 +1,62 @@
+package mtsp
+
+import "git.solver4all.com/azaryc2s/gorobi/gurobi"
+
+/* Combinatorial no-good cuts: NOGOOD on the exact set of assigned nodes, NOGOOD_MIS on a minimal subset exceeding the incumbent. */
+
+//If vehicle i serves exactly the nodes of the tour, its route takes at least tourLength:
+//Cmax >= tourLength - tourLength*(sum_{j in S}(1-X_ij) + sum_{j not in S}X_ij) (or R_i instead of Cmax)
+func getExactNoGoodCut(model *MTSPModel, i int, tour []int, tourLength int) (ind []int32, val []float64, op int8, rhs float64) {
+	inTour := make([]bool, model.N)
+	for _, j := range tour {
+		inTour[j] = true
+	}
+	count := 0
+	for j := 1; j < model.N; j++ {
+		ind = append(ind, int32(GetNodeIndex(i, j, model.N, model.XStart)))
+		if inTour[j] {
+			val = append(val, float64(-tourLength))
+			count++
+		} else {
+			val = append(val, float64(tourLength))
+		}
+	}
+	ind = append(ind, int32(model.routeVar(i)))
+	val = append(val, 1.0)
+	model.CutsBendersCount++
+	Log(3, "Adding exact no-good cut nr.%d: %s >= %d for vehicle %d serving exactly %v", model.CutsBendersCount, model.VarNames[model.routeVar(i)], tourLength, i, tour)
+	return ind, val, gurobi.GREATER_EQUAL, float64(tourLength - tourLength*count)
+}
+
+//minimalNoGoodTour removes the nodes from the tour of vehicle i one by one, as long as the optimal tour through the remaining nodes
+//is longer than the bound on the route of the incumbent. Returns the reduced tour and its length, or the given ones if there is no bound
+func (model *MTSPModel) minimalNoGoodTour(i int, tour []int, tourLength int) ([]int, int) {
+	bound := model.fixingBound(i)
+	if bound <= 0 || tourLength <= bound {
+		return tour, tourLength
+	}
+	nodes := make([]int, 0, len(tour))
+	for _, j := range tour {
+		if j != 0 {
+			nodes = append(nodes, j)
+		}
+	}
+	for p := 0; p < len(nodes) && len(nodes) > 1; {
+		indx := append([]int{0}, nodes[:p]...)
+		indx = append(indx, nodes[p+1:]...)
+		subTour, subLength, _, isFeasible, err := model.solveSubproblem(i, indx)
+		if err != nil || !isFeasible || subTour == nil || subLength <= bound {
+			//the node is needed to exceed the bound
+			p++
+			continue
+		}
+		nodes = indx[1:]
+		tour = make([]int, len(subTour))
+		for k := 0; k < len(subTour); k++ {
+			tour[k] = indx[subTour[k]]
+		}
+		tourLength = subLength
+	}
+	Log(3, "Reduced the no-good set of vehicle %d to %v with length %d above the bound %d", i, tour, tourLength, bound)
+	return tour, tourLength
+}
@@ -0,0 +1,95 @@
+package mtsp
+
+import (
+	"git.solver4all.com/azaryc2s/gorobi/gurobi"
+	"git.solver4all.com/azaryc2s/tsp"
+)
+
+/* Solves the shortest hamiltonian path starting at node 0 with a free end, closed to a tour by a dummy node. */
+
+func SolveOpenTSP(d [][]int, gurobiEnv *gurobi.Env) (tour []int, length int) {
+	n := len(d)
+	if n <= 2 {
+		tour = make([]int, n)
+		for j := 0; j < n; j++ {
+			tour[j] = j
+		}
+		if n == 2 {
+			length = d[0][1]
+		}
+		return tour, length
+	}
+	big := 1
+	for j := 0; j < n; j++ {
+		max := 0
+		for k := 0; k < n; k++ {
+			if d[j][k] > max {
+				max = d[j][k]
+			}
+		}
+		big += max
+	}
+	dummy := n
+	e := make([][]int, n+1)
+	for j := 0; j <= n; j++ {
+		e[j] = make([]int, n+1)
+		if j == dummy {
+			continue
+		}
+		for k := 0; k < n; k++ {
+			e[j][k] = d[j][k]
+			if (j == 0) != (k == 0) {
+				e[j][k] += big
+			}
+		}
+	}
+
+	cycle, cycleLength, _ := tsp.SolveTSP(e, gurobiEnv)
+	if cycle == nil || cycleLength < 0 {
+		return nil, -1
+	}
+	start := 0
+	for j := 0; j < len(cycle); j++ {
+		if cycle[j] == 0 {
+			start = j
+			break
+		}
+	}
+	//rotate the cycle to start at the depot and walk away from the dummy node
+	step := 1
+	if cycle[(start+1)%len(cycle)] == dummy {
+		step = len(cycle) - 1
+	}
+	tour = make([]int, 0, n)
+	for j, k := 0, start; j < len(cycle); j, k = j+1, (k+step)%len(cycle) {
+		if cycle[k] == dummy {
+			continue
+		}
+		tour = append(tour, cycle[k])
+	}
+	return tour, cycleLength - big
+}
+
+//openRouteMatrix returns a copy of d, in which returning to the depot costs nothing
+func openRouteMatrix(d [][]int) [][]int {
+	od := make([][]int, len(d))
+	for j := 0; j < len(d); j++ {
+		od[j] = make([]int, len(d[j]))
+		copy(od[j], d[j])
+		od[j][0] = 0
+	}
+	return od
+}
+
+//OrientOpenRoute reverses the closed tour starting at the depot if needed, so that the longer of its two depot edges is the one not driven
+func OrientOpenRoute(tour []int, d [][]int) []int {
+	if len(tour) < 3 || d[0][tour[1]] <= d[0][tour[len(tour)-1]] {
+		return tour
+	}
+	reversed := make([]int, len(tour))
+	reversed[0] = tour[0]
+	for j := 1; j < len(tour); j++ {
+		reversed[j] = tour[len(tour)-j]
+	}
+	return reversed
+}
@@ -0,0 +1,93 @@
+package mtsp
+
+import "sort"
+
+/* Pool of the best solutions, that differ by at least MinDistance nodes served by other routes. */
+
+//PoolSolution is one solution of the pool
+type PoolSolution struct {
+	Obj        int     `json:"obj"`
+	RouteCosts []int   `json:"route_costs"`
+	Routes     [][]int `json:"routes"`
+}
+
+//SolutionPool keeps the Size best solutions with pairwise assignment distances of at least MinDistance
+type SolutionPool struct {
+	Size        int
+	MinDistance int
+	Solutions   []PoolSolution
+}
+
+//NewSolutionPool returns an empty pool for size solutions
+func NewSolutionPool(size int, minDistance int) *SolutionPool {
+	return &SolutionPool{Size: size, MinDistance: minDistance}
+}
+
+//AddToPool adds the solution to the pool of the model, if it is good and diverse enough. Reports whether the pool changed
+func (model *MTSPModel) AddToPool(routes [][]int, routeCosts []int) bool {
+	pool := model.Pool
+	if pool == nil || pool.Size <= 0 {
+		return false
+	}
+	cand := PoolSolution{Obj: model.objValue(routes, routeCosts), RouteCosts: append([]int{}, routeCosts...), Routes: make([][]int, len(routes))}
+	for i := 0; i < len(routes); i++ {
+		cand.Routes[i] = append([]int{}, routes[i]...)
+	}
+	for p := 0; p < len(pool.Solutions); p++ {
+		if model.AssignmentDistance(cand.Routes, pool.Solutions[p].Routes) < pool.MinDistance {
+			if !model.isBetter(cand.Obj, pool.Solutions[p].Obj) {
+				return false
+			}
+			//the better one replaces the close one, which may also be close to others
+			pool.Solutions = append(pool.Solutions[:p], pool.Solutions[p+1:]...)
+			p--
+		}
+	}
+	pool.Solutions = append(pool.Solutions, cand)
+	sort.SliceStable(pool.Solutions, func(a, b int) bool { return model.isBetter(pool.Solutions[a].Obj, pool.Solutions[b].Obj) })
+	if len(pool.Solutions) > pool.Size {
+		pool.Solutions = pool.Solutions[:pool.Size]
+	}
+	Log(3, "Added a solution with objective %d to the pool, which has %d solutions now", cand.Obj, len(pool.Solutions))
+	return true
+}
+
+//AssignmentDistance returns the number of nodes, that are not served by the same route in both solutions.
+//The routes of vehicles of the same class are matched greedily by their common nodes
+func (model *MTSPModel) AssignmentDistance(a, b [][]int) int {
+	served := 0
+	vehicleA := make([][]bool, len(a))
+	for i := 0; i < len(a); i++ {
+		vehicleA[i] = make([]bool, model.N)
+		for _, j := range a[i] {
+			if j != 0 {
+				vehicleA[i][j] = true
+				served++
+			}
+		}
+	}
+	matched := make([]bool, len(b))
+	common := 0
+	for i := 0; i < len(a); i++ {
+		best, bestCommon := -1, -1
+		for k := 0; k < len(b); k++ {
+			if matched[k] || (k != i && !model.isSameVehicleClass(i, k)) {
+				continue
+			}
+			count := 0
+			for _, j := range b[k] {
+				if j != 0 && vehicleA[i][j] {
+					count++
+				}
+			}
+			if count > bestCommon {
+				best, bestCommon = k, count
+			}
+		}
+		if best >= 0 {
+			matched[best] = true
+			common += bestCommon
+		}
+	}
+	return served - common
+}
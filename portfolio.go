@@ -0,0 +1,87 @@
+package mtsp
+
+import (
+	"math"
+	"sync"
+)
+
+/* Incumbent shared by the concurrent runs of a portfolio, which are terminated once one of them proves optimality. */
+
+//SharedIncumbent is the best solution of all runs of a portfolio, safe for concurrent use
+type SharedIncumbent struct {
+	mu         sync.Mutex
+	prize      bool
+	obj        int
+	routes     [][]int
+	routeCosts []int
+	source     string
+	winner     string
+	done       bool
+}
+
+//NewSharedIncumbent returns an empty incumbent for the objective
+func NewSharedIncumbent(objective MTSPObjective) *SharedIncumbent {
+	s := &SharedIncumbent{prize: objective.Prize, obj: math.MaxInt32}
+	if objective.Prize {
+		s.obj = -1
+	}
+	return s
+}
+
+//Offer replaces the incumbent by the solution of the run source, if it is better. Reports whether it was better
+func (s *SharedIncumbent) Offer(obj int, routes [][]int, routeCosts []int, source string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if (s.prize && obj <= s.obj) || (!s.prize && obj >= s.obj) {
+		return false
+	}
+	s.obj, s.routes, s.routeCosts, s.source = obj, routes, routeCosts, source
+	Log(2, "Portfolio: the run %s found the new best objective %d", source, obj)
+	return true
+}
+
+//Best returns the incumbent and the run, that found it. routes is nil if there is none
+func (s *SharedIncumbent) Best() (obj int, routes [][]int, routeCosts []int, source string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.obj, s.routes, s.routeCosts, s.source
+}
+
+//Finish stops all runs, since the run winner has proven optimality. Only the first call counts
+func (s *SharedIncumbent) Finish(winner string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.done {
+		s.done = true
+		s.winner = winner
+	}
+}
+
+//Winner returns the run, that has proven optimality, or "" if none has
+func (s *SharedIncumbent) Winner() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.winner
+}
+
+//Done reports whether the runs have to stop
+func (s *SharedIncumbent) Done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done
+}
+
+//syncIncumbent offers the best solution of the model to the shared incumbent and takes over the shared one, if it is better
+func (model *MTSPModel) syncIncumbent() {
+	if model.BestSol.Routes != nil {
+		model.Shared.Offer(model.BestSol.Obj, model.BestSol.Routes, model.BestSol.RouteCosts, model.Name)
+	}
+	obj, routes, routeCosts, source := model.Shared.Best()
+	if routes != nil && model.isBetter(obj, model.BestSol.Obj) {
+		Log(3, "Taking over the solution with objective %d of the run %s", obj, source)
+		model.BestSol.Obj = obj
+		model.BestSol.Routes = routes
+		model.BestSol.RouteCosts = routeCosts
+		model.NewBestSol = true
+	}
+}
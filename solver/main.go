@@ -9,12 +9,12 @@ import (
 	"fmt"
 	"git.solver4all.com/azaryc2s/gorobi/gurobi"
 	"git.solver4all.com/azaryc2s/mtsp"
-	"git.solver4all.com/azaryc2s/tsp"
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/host"
 	"github.com/shirou/gopsutil/mem"
 	"io/ioutil"
 	"math"
+	"sort"
 
 	//"log"
 	//"os"
@@ -22,8 +22,20 @@ import (
 	"time"
 )
 
+//parameters and attributes of gurobi's solution pool
+const (
+	intParPoolSearchMode  = "PoolSearchMode"
+	intParPoolSolutions   = "PoolSolutions"
+	intParSolutionNumber  = "SolutionNumber"
+	dblAttrXn             = "Xn"
+	poolSearchFactor      = 5
+)
+
 var (
 	edgeDist [][]int
+	candidateEdges [][]bool
+	lowerBound     *mtsp.LowerBound
+	prevPhaseTime  time.Duration //time of the previous phases of a multi-phase solve, added to the time of the next one
 	sol      mtsp.MTSPSolution
 	pInst    mtsp.MTSPInstance
 
@@ -35,20 +47,66 @@ var (
 	lBoundStrat *string
 	subtourIneq *string
 	masterModel       *string
+	openRoutes  *bool
+	objective   *string
+	wCMax       *int
+	wTotal      *int
+	optional    *bool
+	maxVehicles *int
+	maxDuration *int
+	edges       *string
+	kNeighbours *int
+	priceEdges  *bool
+	fixVars     *bool
+	lnsIterations *int
+	lnsTime       *int
+	lnsVehicles   *int
+	lnsNodes      *int
+	lnsReaction   *float64
+	lnsSeed       *int64
+	rebalanceMoves *int
+	poolSize       *int
+	poolDistance   *int
+	portfolio      *string
+	localSearch *bool
+	balance     *bool
 	logLvl      *int
 )
 
 func main() {
 	var err error
 
-	flag.Var(&cuts, "cuts", "List of cuts to be used. Possible:  {BEND_V1 , BEND_V2, BEND_V3, SEC}")
-	strat = flag.String("strat", "BCH", "Strategy for solving. BCH (default) or LP")
-	masterModel = flag.String("model", "TSP", "How the master problem is to be modelled. Possible: {TSP,ATSP}. Default TSP.")
-	subtourIneq = flag.String("subtourIneq", "none", "Define integer-subtour-classes to be added to the master-problem. Default none. Possible: {MTZ}")
+	flag.Var(&cuts, "cuts", "List of cuts to be used. Possible:  {BEND_V1 , BEND_V2, BEND_V3, SEC, NOGOOD, NOGOOD_MIS, BEND_LP}. BEND_LP is the Benders cut from the duals of the LP relaxation of the vehicle's TSP, NOGOOD is the exact no-good cut on the assigned nodes, NOGOOD_MIS its strengthening by a minimal subset exceeding the incumbent. NOGOOD_MIS assumes the triangle inequality and may cut off optimal solutions otherwise, BEND_LP adds NOGOOD cuts instead for open routes")
+	strat = flag.String("strat", "BCH", "Strategy for solving. BCH (default), LP, LNS or CLUSTER. LNS is a large neighbourhood search repairing parts of the solution with the BCH, CLUSTER a heuristic cluster-first route-second decomposition for very large instances without time windows, maximal number of vehicles or fixed costs")
+	masterModel = flag.String("model", "TSP", "How the master problem is to be modelled. Possible: {TSP,ATSP,SP}. Default TSP. SP is the set-partitioning model solved by branch-and-price, only for the MAKESPAN objective")
+	subtourIneq = flag.String("subtourIneq", "none", "Define integer-subtour-classes to be added to the master-problem. Default none. Possible: {MTZ,SCF,GG}. MTZ only for the ATSP model")
 	inputF = flag.String("input", "input.json", "Path to the input instance")
-	lBoundStrat = flag.String("lbstrat", "none", "Strategy for setting a lower bound. Default none, possible: TSP")
+	lBoundStrat = flag.String("lbstrat", "none", "Strategies for the lower bound on the makespan, separated by commas. The best one is set. Default none, possible: {FARTHEST,MST,TSP,LP,ALL}. TSP assumes the triangle inequality and may exceed the optimum otherwise")
 	yBounds = flag.String("yBounds", mtsp.Y_BOUNDS_CONT, "Bounds of the Y-Variables. CONT|BIN")
 	outputF = flag.String("output", "", "Path to the output file. By default the input file will be overwritten adding the solution")
+	openRoutes = flag.Bool("open", false, "Open routes: the vehicles do not return to the depot after their last node")
+	objective = flag.String("obj", mtsp.OBJ_MAKESPAN, "Objective to optimize. Possible: {MAKESPAN,TOTAL,WEIGHTED,LEX,PRIZE}. Default MAKESPAN. LEX minimizes the total cost among the solutions with minimal makespan, PRIZE maximizes the collected prices with routes not longer than tmax")
+	wCMax = flag.Int("wCmax", 1, "Weight of the makespan in the WEIGHTED objective")
+	wTotal = flag.Int("wTotal", 1, "Weight of the total cost in the WEIGHTED objective")
+	optional = flag.Bool("optional", false, "Vehicles may stay at the depot. Implied by fixed costs or a maximal number of vehicles in the instance")
+	maxVehicles = flag.Int("maxVehicles", 0, "Maximal number of vehicles to be used. Default 0 (all vehicles may be used)")
+	maxDuration = flag.Int("maxDuration", 0, "Maximal duration of each route (shift length), if the instance does not define the durations per vehicle. Default 0 (no limit)")
+	edges = flag.String("edges", mtsp.EDGES_ALL, "Candidate graph of the master problem. Possible: {ALL,KNN,DELAUNAY,TOURS}. Default ALL. KNN uses the k nearest neighbours of each node, TOURS the union of k heuristic tours")
+	kNeighbours = flag.Int("k", 10, "Number of neighbours or tours for the candidate graph")
+	priceEdges = flag.Bool("priceEdges", false, "Re-add the missing edges of the candidate graph, that could improve the solution, and solve again until optimality is proven")
+	localSearch = flag.Bool("ls", false, "Improve the heuristic solutions of the BCH callback by relocate, swap, cross-exchange and 2-opt* moves between the routes")
+	lnsIterations = flag.Int("lnsIter", 100, "Number of destroy and repair iterations of the LNS strategy")
+	lnsTime = flag.Int("lnsTime", 0, "Time limit of the LNS strategy in seconds, checked after each iteration. Default 0 (no limit)")
+	lnsVehicles = flag.Int("lnsVehicles", 2, "Number of vehicles, whose routes are destroyed by the VEHICLES operator of the LNS")
+	lnsNodes = flag.Int("lnsNodes", 15, "Number of nodes around a random node, that are freed by the REGION operator of the LNS")
+	lnsReaction = flag.Float64("lnsReaction", 0.2, "Reaction factor of the adaptive choice of the LNS destroy operators, between 0 (fixed) and 1")
+	lnsSeed = flag.Int64("lnsSeed", 1, "Seed of the random choices of the LNS")
+	rebalanceMoves = flag.Int("rebalance", 1000, "Maximal number of nodes moved between the clusters to rebalance the routes of the CLUSTER strategy")
+	poolSize = flag.Int("pool", 0, "Number of the best distinct solutions to be written as alternatives. Default 0 (none)")
+	poolDistance = flag.Int("poolDist", 1, "Minimal number of nodes, that two solutions of the pool have to serve by different routes")
+	portfolio = flag.String("portfolio", "", "Configurations model:cuts:yBounds separated by semicolons, e.g. TSP:BEND_V1:CONT;ATSP:NOGOOD,SEC:BIN. They are solved concurrently by the BCH strategy, sharing their incumbent, until one proves optimality")
+	fixVars = flag.Bool("fix", false, "Fix the assignments and edges to zero, that can not be part of a route within the duration limits or the makespan of the best known solution")
+	balance = flag.Bool("balance", false, "After minimizing the makespan, also minimize the second longest route, then the third and so on. Only with the MAKESPAN objective")
 	logLvl = flag.Int("log", 2, "Level of the logging output. Higher value is more verbose. Range 1-3")
 
 	flag.Parse()
@@ -72,7 +130,39 @@ func main() {
 		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
 		return
 	}
+	diags := mtsp.ValidateInstance(&pInst)
+	for _, diag := range diags {
+		if diag.Severity == mtsp.SEVERITY_ERROR {
+			mtsp.Log(1, "At %s: %s\n", *inputF, diag.String())
+		} else {
+			mtsp.Log(2, "At %s: %s\n", *inputF, diag.String())
+		}
+	}
+	if mtsp.HasErrors(diags) {
+		return
+	}
 	edgeDist = mtsp.CalcEdgeDist(pInst.NodeCoordinates, pInst.EdgeWeightType)
+	candidateEdges = mtsp.CandidateEdges(*edges, edgeDist, pInst.NodeCoordinates, *kNeighbours)
+	if *openRoutes {
+		pInst.OpenRoutes = true
+		for _, cut := range cuts {
+			if cut == mtsp.CUT_BEND_LP {
+				mtsp.Log(2, "At %s: %s cuts do not support open routes, the exact no-good cuts are added instead\n", *inputF, mtsp.CUT_BEND_LP)
+			}
+		}
+	}
+	if *optional {
+		pInst.OptionalVehicles = true
+	}
+	if *maxVehicles > 0 {
+		pInst.MaxVehicles = *maxVehicles
+	}
+	if *maxDuration > 0 && pInst.MaxDurations == nil {
+		pInst.MaxDurations = make([]int, len(pInst.TravelSpeeds))
+		for i := 0; i < len(pInst.MaxDurations); i++ {
+			pInst.MaxDurations[i] = *maxDuration
+		}
+	}
 	pInst.Solution = &sol
 
 	// Create environment
@@ -83,86 +173,362 @@ func main() {
 	}
 	defer env.Free()
 	threads, _ := env.GetIntParam(gurobi.INT_PAR_THREADS)
-	sol.Comment = fmt.Sprintf("Solver-Settings: SolverDev: Zarychta, Threads=%d, Strat=%s, yBounds=%s, Cuts=%s", threads, *strat, *yBounds, cuts.String())
+	sol.Comment = fmt.Sprintf("Solver-Settings: SolverDev: Zarychta, Threads=%d, Strat=%s, yBounds=%s, Cuts=%s, Obj=%s. ", threads, *strat, *yBounds, cuts.String(), *objective)
+	sol.Objective = *objective
 	var bounds int8
 	if *yBounds == mtsp.Y_BOUNDS_CONT {
 		bounds = gurobi.CONTINUOUS
 	} else {
 		bounds = gurobi.BINARY
 	}
-	model, err := mtsp.CreateMTSPModel(env, edgeDist, pInst.TravelSpeeds, gurobi.BINARY, bounds, *masterModel, *subtourIneq)
+	var obj mtsp.MTSPObjective
+	if *objective == mtsp.OBJ_MAKESPAN || *objective == mtsp.OBJ_LEX {
+		obj = mtsp.MTSPObjective{WCMax: 1}
+	} else if *objective == mtsp.OBJ_TOTAL {
+		obj = mtsp.MTSPObjective{WTotal: 1}
+	} else if *objective == mtsp.OBJ_WEIGHTED {
+		obj = mtsp.MTSPObjective{WCMax: *wCMax, WTotal: *wTotal}
+	} else if *objective == mtsp.OBJ_PRIZE {
+		if pInst.Prices == nil || pInst.TMax <= 0 {
+			mtsp.Log(1, "At %s: the %s objective needs the prices and tmax of the instance\n", *inputF, mtsp.OBJ_PRIZE)
+			return
+		}
+		obj = mtsp.MTSPObjective{Prize: true}
+	} else {
+		mtsp.Log(1, "Unsupported objective : %s\n", *objective)
+		return
+	}
+	if *balance && *objective != mtsp.OBJ_MAKESPAN {
+		mtsp.Log(1, "Balancing the routes is only supported with the %s objective\n", mtsp.OBJ_MAKESPAN)
+		return
+	}
+	if unservable := pInst.UnservableNodes(edgeDist); len(unservable) > 0 && !obj.Prize {
+		mtsp.Log(1, "The instance %s is infeasible: no vehicle can serve the nodes %v\n", *inputF, unservable)
+		sol.Infeasible = true
+		sol.Comment += fmt.Sprintf("The instance is infeasible: no vehicle can serve the nodes %v. ", unservable)
+		writeSolution()
+		return
+	}
+	if *masterModel == mtsp.MASTERMODEL_SP {
+		if *objective != mtsp.OBJ_MAKESPAN || *balance {
+			mtsp.Log(1, "The %s model only supports the %s objective\n", mtsp.MASTERMODEL_SP, mtsp.OBJ_MAKESPAN)
+			return
+		}
+		solveBySP(env)
+		reportValidity(sol.Obj)
+		return
+	}
+	if !obj.Prize {
+		computeLowerBound(env)
+	}
+	if *strat == mtsp.STRAT_LNS || *strat == mtsp.STRAT_CLUSTER {
+		if obj.Prize || *balance {
+			mtsp.Log(1, "The %s strategy does not support the %s objective or balancing\n", *strat, mtsp.OBJ_PRIZE)
+			return
+		}
+		if *strat == mtsp.STRAT_LNS {
+			solveByLNS(env, obj, bounds)
+		} else {
+			solveByClusters(obj)
+		}
+		cMaxBound := sol.Makespan
+		if *objective == mtsp.OBJ_MAKESPAN {
+			cMaxBound = sol.Obj
+		}
+		reportValidity(cMaxBound)
+		return
+	}
+	if *portfolio != "" {
+		if *balance || *objective == mtsp.OBJ_LEX {
+			mtsp.Log(1, "The portfolio does not support balancing or the %s objective\n", mtsp.OBJ_LEX)
+			return
+		}
+		solvePortfolio(obj)
+		cMaxBound := sol.Makespan
+		if *objective == mtsp.OBJ_MAKESPAN {
+			cMaxBound = sol.Obj
+		} else if *objective == mtsp.OBJ_PRIZE {
+			cMaxBound = pInst.TMax
+		}
+		reportValidity(cMaxBound)
+		return
+	}
+	model, err := mtsp.CreateMTSPModel(env, &pInst, edgeDist, gurobi.BINARY, bounds, *masterModel, *subtourIneq, candidateEdges, obj)
 	if err != nil {
 		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
 		return
 	}
-	if *lBoundStrat == mtsp.LBSTRAT_TSP {
-		tspTour, tspLength, _ := tsp.SolveTSP(edgeDist, env)
-		mtsp.Log(2, "TSP-Length for this graph is: %d", tspLength)
-		sol.TSPLength = tspLength
-		var vehSpeedSum float64
-		ind := []int32{int32(model.CMax)}
-		val := []float64{1.0}
-		minEdge := -1
-		for j := 0; j < len(edgeDist); j++ {
-			for k := j + 1; k < len(edgeDist); k++ {
-				if minEdge < 0 || minEdge > edgeDist[j][k] {
-					minEdge = edgeDist[j][k]
-				}
-			}
+	setLowerBound(&model)
+	fixVariables(&model)
+	// Write model to '<fileName>.lp'
+	lpName := strings.ReplaceAll(*inputF, ".json", ".lp")
+	err = model.GModel.Write(lpName)
+	if err != nil {
+		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+		return
+	}
+	if !solveModel(&model) {
+		return
+	}
+	//the solution is only optimal for the candidate graph, until no missing edge can improve it
+	for *priceEdges && candidateEdges != nil && sol.Optimal {
+		added, err := mtsp.PriceEdges(env, &pInst, edgeDist, *masterModel, *subtourIneq, obj, candidateEdges, sol.Obj)
+		if err != nil {
+			mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+			break
 		}
-
-		maxTourEdge := 0
-		for j := 0; j < len(tspTour); j++ {
-			k := (j + 1) % len(tspTour)
-			if maxTourEdge < edgeDist[j][k] {
-				maxTourEdge = edgeDist[j][k]
-			}
+		if added == 0 {
+			sol.Comment += "No missing edge of the candidate graph can improve the solution. "
+			writeSolution()
+			break
 		}
+		model.GModel.Free()
+		model, err = mtsp.CreateMTSPModel(env, &pInst, edgeDist, gurobi.BINARY, bounds, *masterModel, *subtourIneq, candidateEdges, obj)
+		if err != nil {
+			mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+			return
+		}
+		setLowerBound(&model)
+		fixVariables(&model)
+		prevTime, _ := time.ParseDuration(sol.Time)
+		sol.Routes = nil
+		sol.RouteCosts = nil
+		sol.Optimal = false
+		if !solveModel(&model) {
+			return
+		}
+		solveTime, _ := time.ParseDuration(sol.Time)
+		sol.Time = (prevTime + solveTime).String()
+	}
+	//the routes have to respect the makespan, which is the objective value only for the makespan objective
+	cMaxBound := sol.Makespan
+	if *objective == mtsp.OBJ_MAKESPAN {
+		cMaxBound = sol.Obj
+	} else if *objective == mtsp.OBJ_PRIZE {
+		cMaxBound = pInst.TMax
+	} else if *objective == mtsp.OBJ_LEX && sol.Routes != nil {
+		cMaxBound = sol.Makespan
+		solveLexicographic(env, bounds)
+	}
+	if *balance && sol.Routes != nil {
+		cMaxBound = sol.Makespan
+		solveBalanced(env, bounds)
+	}
 
-		tspLength -= (len(pInst.TravelSpeeds) - 1) * maxTourEdge //for each vehicle, we do not use one edge of the tsp in the solution - worst case the longest
+	reportValidity(cMaxBound)
+}
 
-		minSpeedF := -1
-		for i := 0; i < len(pInst.TravelSpeeds); i++ {
-			if minSpeedF < 0 || minSpeedF > pInst.TravelSpeeds[i] {
-				minSpeedF = pInst.TravelSpeeds[i]
+//computeLowerBound computes the lower bounds on the makespan of the strategies given by -lbstrat and keeps the best one
+func computeLowerBound(env *gurobi.Env) {
+	strategies := strings.Split(*lBoundStrat, ",")
+	if *lBoundStrat == mtsp.LBSTRAT_ALL {
+		strategies = []string{mtsp.LBSTRAT_FARTHEST, mtsp.LBSTRAT_MST, mtsp.LBSTRAT_TSP, mtsp.LBSTRAT_LP}
+	}
+	for _, strategy := range strategies {
+		var lb mtsp.LowerBound
+		if strategy == mtsp.LBSTRAT_FARTHEST {
+			lb = mtsp.FarthestNodeBound(&pInst, edgeDist)
+		} else if strategy == mtsp.LBSTRAT_MST {
+			lb = mtsp.TreeBound(&pInst, edgeDist)
+		} else if strategy == mtsp.LBSTRAT_TSP {
+			if pInst.OpenRoutes {
+				mtsp.Log(1, "The TSP lower bound does not hold for open routes and will not be set")
+				continue
 			}
+			var tspLength int
+			lb, tspLength = mtsp.TSPBound(env, &pInst, edgeDist)
+			mtsp.Log(2, "TSP-Length for this graph is: %d", tspLength)
+			sol.TSPLength = tspLength
+		} else if strategy == mtsp.LBSTRAT_LP {
+			var err error
+			lb, err = mtsp.LPBound(env, &pInst, edgeDist, *masterModel, *subtourIneq)
+			if err != nil {
+				mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+				continue
+			}
+		} else {
+			if strategy != "none" {
+				mtsp.Log(1, "Unsupported lower bound strategy: %s\n", strategy)
+			}
+			continue
 		}
-
-		for i := 0; i < len(pInst.TravelSpeeds); i++ {
-			vehSpeedSum += float64(1) / float64(pInst.TravelSpeeds[i])
-			tspLength += minEdge //but we also need one edge more for each vehicle, cause it has to close the cycle
+		mtsp.Log(2, "The %s lower bound on the makespan is %.2f", lb.Strategy, lb.Value)
+		if lowerBound == nil || lb.Value > lowerBound.Value {
+			lowerBound = &lb
 		}
-		model.GModel.AddConstr(ind, val, gurobi.GREATER_EQUAL, float64(tspLength)/vehSpeedSum, "tspLBound")
-		mtsp.Log(2, "Set the TSPLBound: CMax >= %.2f", float64(tspLength)/vehSpeedSum)
 	}
-	// Write model to '<fileName>.lp'
-	lpName := strings.ReplaceAll(*inputF, ".json", ".lp")
-	err = model.GModel.Write(lpName)
+	if lowerBound != nil {
+		sol.CMaxLBound = int(math.Ceil(lowerBound.Value - 1e-6))
+		sol.LBoundSource = lowerBound.Strategy
+	}
+}
+
+//setLowerBound adds the best lower bound on the makespan to the model
+func setLowerBound(model *mtsp.MTSPModel) {
+	if lowerBound == nil {
+		return
+	}
+	err := model.SetCMaxLowerBound(*lowerBound)
 	if err != nil {
 		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+	}
+}
+
+//fixVariables starts the BCH from the routes of the insertion heuristic and fixes the variables, that are excluded by its bound
+func fixVariables(model *mtsp.MTSPModel) {
+	if !*fixVars {
 		return
 	}
+	model.Fixing = true
+	if *strat == mtsp.STRAT_BCH {
+		//only the BCH callback keeps track of the best solution, the LP strategy can only use the duration limits
+		if routes := pInst.InsertionHeuristic(edgeDist); routes != nil {
+			model.SetInitialSolution(routes)
+		}
+	}
+	_, err := model.FixVariables()
+	if err != nil {
+		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+	}
+}
+
+//reportValidity checks the solution with routes not longer than cMaxBound and logs the result
+func reportValidity(cMaxBound int) {
+	solValid, validComment := mtsp.CheckSolutionValidity(&pInst, sol.Routes, edgeDist, cMaxBound)
+	if !solValid {
+		mtsp.Log(1, validComment)
+	} else {
+		mtsp.Log(1,"The computed solution is valid! ")
+	}
+	mtsp.Log(2, "Found a hmmVRP-Solution with obj-Value of %d\n", sol.Obj)
+}
+
+//solveModel solves the model with the chosen strategy and reports whether the strategy is supported
+func solveModel(model *mtsp.MTSPModel) bool {
+	if *poolSize > 0 {
+		model.Pool = mtsp.NewSolutionPool(*poolSize, *poolDistance)
+	}
 	if *strat == mtsp.STRAT_LP {
-		solveBySEC(&model)
+		if pInst.TimeWindows != nil {
+			mtsp.Log(1, "Time windows are only supported by the %s strategy\n", mtsp.STRAT_BCH)
+			return false
+		}
+		solveBySEC(model)
 	} else if *strat == mtsp.STRAT_BCH {
 		model.GCuts = cuts
-		solveByBCH(&model)
+		model.LocalSearch = *localSearch
+		solveByBCH(model)
 	} else {
 		mtsp.Log(1, "Unsupported strategy : %s\n", *strat)
+		return false
+	}
+	return true
+}
+
+//solveLexicographic minimizes the total cost among the solutions with the makespan found in the first phase
+func solveLexicographic(env *gurobi.Env, bounds int8) {
+	cMax := sol.Makespan
+	phase1Time, _ := time.ParseDuration(sol.Time)
+	mtsp.Log(2, "Lexicographic objective: minimizing the total cost subject to Cmax <= %d", cMax)
+	model, err := mtsp.CreateMTSPModel(env, &pInst, edgeDist, gurobi.BINARY, bounds, *masterModel, *subtourIneq, candidateEdges, mtsp.MTSPObjective{WTotal: 1})
+	if err != nil {
+		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+		return
+	}
+	err = model.GModel.AddConstr([]int32{int32(model.CMax)}, []float64{1.0}, gurobi.LESS_EQUAL, float64(cMax), "lexCMax")
+	if err != nil {
+		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
 		return
 	}
+	model.CMaxUB = cMax
+	//the solution of the first phase is a feasible start for the second one
+	seedBestSol(&model, sol.TotalCost, sol.Routes, sol.RouteCosts)
 
-	solValid, validComment := mtsp.CheckSolutionValidity(sol.Routes, edgeDist, pInst.TravelSpeeds, sol.Obj)
-	if !solValid {
-		mtsp.Log(1, validComment)
-	} else {
-		mtsp.Log(1,"The computed solution is valid! ")
+	sol.Comment += fmt.Sprintf("Lexicographic phase 1: Cmax=%d, Optimal=%t, Time=%s. ", cMax, sol.Optimal, sol.Time)
+	sol.Routes = nil
+	sol.RouteCosts = nil
+	sol.Optimal = false
+	//captureSolution adds the time of the first phase, before it writes the solution
+	prevPhaseTime = phase1Time
+	solveModel(&model)
+}
+
+//solveBalanced minimizes the second longest route while keeping the makespan, then the third longest keeping both and so on.
+//Each level bounds the sum of the longest routes by the value found before, so a level not solved to optimality still yields a feasible plan
+func solveBalanced(env *gurobi.Env, bounds int8) {
+	M := len(pInst.TravelSpeeds)
+	totalTime, _ := time.ParseDuration(sol.Time)
+	lBound := sol.LBound
+	sol.BalanceLevels = []mtsp.BalanceLevel{{Level: 1, Value: sol.Makespan, Optimal: sol.Optimal, Time: sol.Time}}
+	levels := []int{sol.Makespan}
+	for k := 2; k <= M; k++ {
+		mtsp.Log(2, "Balancing level %d: minimizing the sum of the %d longest routes subject to the previous levels %v", k, k, levels)
+		model, err := mtsp.CreateMTSPModel(env, &pInst, edgeDist, gurobi.BINARY, bounds, *masterModel, *subtourIneq, candidateEdges, mtsp.MTSPObjective{Levels: levels})
+		if err != nil {
+			mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+			return
+		}
+		//the solution of the previous level is a feasible start for this one
+		prevRoutes := sol.Routes
+		prevCosts := sol.RouteCosts
+		seedBestSol(&model, longestRoutesSum(prevCosts, k), prevRoutes, prevCosts)
+
+		sol.Routes = nil
+		sol.RouteCosts = nil
+		sol.Optimal = false
+		if !solveModel(&model) {
+			return
+		}
+		if sol.Routes == nil {
+			mtsp.Log(1, "Balancing level %d did not yield a solution, keeping the previous one", k)
+			sol.Routes = prevRoutes
+			sol.RouteCosts = prevCosts
+			break
+		}
+		levelTime, _ := time.ParseDuration(sol.Time)
+		totalTime += levelTime
+		sum := longestRoutesSum(sol.RouteCosts, k)
+		sol.BalanceLevels = append(sol.BalanceLevels, mtsp.BalanceLevel{Level: k, Value: sum - longestRoutesSum(sol.RouteCosts, k-1), Optimal: sol.Optimal, Time: sol.Time})
+		levels = append(levels, sum)
 	}
-	mtsp.Log(2, "Found a hmmVRP-Solution with obj-Value of %d\n", sol.Obj)
+	//the bounds of the makespan come from the first level
+	sol.Obj = sol.Makespan
+	sol.UBound = sol.Makespan
+	sol.LBound = lBound
+	sol.Optimal = sol.BalanceLevels[0].Optimal
+	sol.Time = totalTime.String()
+	writeSolution()
+}
+
+//seedBestSol starts the BCH from the solution of the previous phase. Only the BCH callback updates the best solution,
+//so with the LP strategy it would be reported instead of the solution of this phase
+func seedBestSol(model *mtsp.MTSPModel, obj int, routes [][]int, routeCosts []int) {
+	if *strat != mtsp.STRAT_BCH {
+		return
+	}
+	model.BestSol = mtsp.MTSPSolution{Obj: obj, Routes: routes, RouteCosts: routeCosts}
+	model.NewBestSol = true
+}
+
+//longestRoutesSum returns the sum of the k longest route costs
+func longestRoutesSum(routeCosts []int, k int) int {
+	sorted := make([]int, len(routeCosts))
+	copy(sorted, routeCosts)
+	sort.Sort(sort.Reverse(sort.IntSlice(sorted)))
+	sum := 0
+	for t := 0; t < k && t < len(sorted); t++ {
+		sum += sorted[t]
+	}
+	return sum
 }
 
 func captureSolution(model *mtsp.MTSPModel) {
 	defer writeSolution()
+	if prevPhaseTime > 0 {
+		solveTime, _ := time.ParseDuration(sol.Time)
+		sol.Time = (prevPhaseTime + solveTime).String()
+		prevPhaseTime = 0
+	}
 	gmodel := model.GModel
 	// Capture solution information
 	optimstatus, err := gmodel.GetIntAttr(gurobi.INT_ATTR_STATUS)
@@ -173,8 +539,12 @@ func captureSolution(model *mtsp.MTSPModel) {
 
 	if optimstatus == gurobi.OPTIMAL {
 		sol.Optimal = true
-	} else if optimstatus == gurobi.INF_OR_UNBD {
-		mtsp.Log(1, "Model for %s is infeasible or unbounded\n", *inputF)
+	} else if optimstatus == gurobi.INFEASIBLE || optimstatus == gurobi.INF_OR_UNBD {
+		//the objective is bounded, so the model can only be infeasible
+		mtsp.Log(1, "Model for %s is infeasible\n", *inputF)
+		sol.Infeasible = true
+		sol.Comment += "The instance is infeasible: no assignment of the nodes to the vehicles satisfies all constraints. "
+		return
 	} else if optimstatus == gurobi.TIME_LIMIT {
 		sol.Comment += "Time limit reached"
 	} else {
@@ -186,14 +556,20 @@ func captureSolution(model *mtsp.MTSPModel) {
 		sol.Comment += fmt.Sprintf("Couldn't retrieve the obj-value: %s. ", err.Error())
 		return
 	}
-	if (objval < 0 || objval + 0.5 < objval) && model.BestSol.Obj == 0{
+	if model.Objective.Prize {
+		//the collected prize is maximized, so the bounds are swapped
+		sol.Obj = int(math.Max(objval, float64(model.BestSol.Obj)) + 0.5)
+		sol.LBound = sol.Obj
+	} else if (objval < 0 || objval + 0.5 < objval) && model.BestSol.Obj == 0{
 		sol.Obj = math.MaxInt32
 	} else if objval > 0 {
 		sol.Obj = int(math.Min(objval, float64(model.BestSol.Obj)) + 0.5)
 	} else {
 		sol.Obj = model.BestSol.Obj
 	}
-	sol.UBound = sol.Obj
+	if !model.Objective.Prize {
+		sol.UBound = sol.Obj
+	}
 
 	lb := 0.0
 	lb, err = gmodel.GetDblAttr(gurobi.DBL_ATTR_OBJBOUND)
@@ -201,18 +577,17 @@ func captureSolution(model *mtsp.MTSPModel) {
 		sol.Comment += fmt.Sprintf("Couldn't retrieve the lower-bound-value: %s. ", err.Error())
 		mtsp.Log(1, err.Error())
 	}
-	sol.LBound = int(lb + 0.5)
+	if model.Objective.Prize {
+		sol.UBound = int(lb + 0.5)
+	} else {
+		sol.LBound = int(lb + 0.5)
+	}
 
 	// Extract solution
 	if model.BestSol.Routes != nil {
 		sol.Routes = model.BestSol.Routes
 		for i := 0; i < len(sol.Routes); i++ {
-			tour := sol.Routes[i]
-			length := 0
-			for j := 0; j < len(tour); j++ {
-				k := (j + 1) % len(tour)
-				length += model.EdgeWeights[tour[j]][tour[k]] * model.TravelSpeeds[i]
-			}
+			length := pInst.RouteCost(i, sol.Routes[i], model.EdgeWeights)
 			sol.RouteCosts = append(sol.RouteCosts, length)
 		}
 	} else {
@@ -228,26 +603,88 @@ func captureSolution(model *mtsp.MTSPModel) {
 				return
 			}
 
-			yMat := mtsp.ExtractEdgeMatrix(solA, model.N, model.M, model.YStart, model.GMastermodel)
-			for i := 0; i < model.M; i++ {
-				tour, isTourInvalid := mtsp.Findsubtour(yMat[i])
-				if isTourInvalid {
-					mtsp.Log(1, "Tour %d is invalid (contains no depot)!\n")
-				}
-				sol.Routes = append(sol.Routes, tour)
-				length := 0
-				for j := 0; j < len(tour); j++ {
-					k := (j + 1) % len(tour)
-					length += edgeDist[tour[j]][tour[k]] * model.TravelSpeeds[i]
-				}
-				sol.RouteCosts = append(sol.RouteCosts, length)
-			}
+			sol.Routes, sol.RouteCosts = extractRoutes(model, solA)
 		}
 	}
-	mtsp.Log(2, "Added %d SECs and %d Benders-Cuts", mtsp.CutsSECCount, mtsp.CutsBendersCount)
+	setSolutionStats()
+	collectPool(model)
+	sol.FixedAssignments = model.FixedXCount
+	sol.FixedEdges = model.FixedYCount
+	mtsp.Log(2, "Eliminated %d of %d assignment variables and %d of %d edge variables", model.FixedXCount, model.XCount, model.FixedYCount, model.YCount)
+	mtsp.Log(2, "Added %d SECs, %d Benders-Cuts and %d Feasibility-Cuts", model.CutsSECCount, model.CutsBendersCount, model.CutsFeasibilityCount)
 	mtsp.Log(2, "Found Tours with CMax %d : %v \n", sol.Obj, sol.Routes)
 }
 
+//extractRoutes returns the routes of the master solution solA and their costs
+func extractRoutes(model *mtsp.MTSPModel, solA []float64) (routes [][]int, routeCosts []int) {
+	yMat := mtsp.ExtractEdgeMatrix(solA, model.N, model.M, model.YStart, model.Edges)
+	for i := 0; i < model.M; i++ {
+		if model.Optional && solA[mtsp.GetNodeIndex(i, 0, model.N, model.XStart)] < 0.5 {
+			//the vehicle is not used
+			routes = append(routes, []int{})
+			routeCosts = append(routeCosts, 0)
+			continue
+		}
+		tour, isTourInvalid := mtsp.Findsubtour(yMat[i])
+		if isTourInvalid {
+			mtsp.Log(1, "Tour %d is invalid (contains no depot)!\n", i)
+		}
+		if pInst.OpenRoutes {
+			tour = mtsp.OrientOpenRoute(tour, edgeDist)
+		}
+		routes = append(routes, tour)
+		length := pInst.RouteCost(i, tour, edgeDist)
+		routeCosts = append(routeCosts, length)
+	}
+	return routes, routeCosts
+}
+
+//collectPool adds the solutions of gurobi's solution pool to the pool of the model, if the master solutions are routes (LP strategy),
+//and writes the valid solutions of the pool into the solution
+func collectPool(model *mtsp.MTSPModel) {
+	if model.Pool == nil {
+		return
+	}
+	if sol.Routes != nil {
+		model.AddToPool(sol.Routes, sol.RouteCosts)
+	}
+	if *strat == mtsp.STRAT_LP {
+		solcount, err := model.GModel.GetIntAttr(gurobi.INT_ATTR_SOLCOUNT)
+		if err != nil {
+			mtsp.Log(1, err.Error())
+			return
+		}
+		for k := int32(0); k < solcount; k++ {
+			err = model.GModel.SetIntParam(intParSolutionNumber, k)
+			if err != nil {
+				mtsp.Log(1, err.Error())
+				return
+			}
+			solA, err := model.GModel.GetDblAttrArray(dblAttrXn, 0, int32(model.VarCount))
+			if err != nil {
+				mtsp.Log(1, err.Error())
+				return
+			}
+			routes, routeCosts := extractRoutes(model, solA)
+			model.AddToPool(routes, routeCosts)
+		}
+	}
+	bound := math.MaxInt32
+	if *objective == mtsp.OBJ_PRIZE {
+		bound = pInst.TMax
+	}
+	sol.Solutions = nil
+	for _, ps := range model.Pool.Solutions {
+		valid, comment := mtsp.CheckSolutionValidity(&pInst, ps.Routes, edgeDist, bound)
+		if !valid {
+			mtsp.Log(1, "The pool solution with objective %d is invalid and will not be written: %s", ps.Obj, comment)
+			continue
+		}
+		sol.Solutions = append(sol.Solutions, ps)
+	}
+	mtsp.Log(2, "The solution pool holds %d distinct solutions", len(sol.Solutions))
+}
+
 func solveBySEC(model *mtsp.MTSPModel) {
 	gmodel := model.GModel
 
@@ -258,6 +695,18 @@ func solveBySEC(model *mtsp.MTSPModel) {
 		return
 	}
 
+	if model.Pool != nil {
+		//search for the best solutions systematically, more than needed, since close ones are filtered out
+		err = gmodel.SetIntParam(intParPoolSearchMode, 2)
+		if err == nil {
+			err = gmodel.SetIntParam(intParPoolSolutions, int32(poolSearchFactor*model.Pool.Size))
+		}
+		if err != nil {
+			mtsp.Log(1, err.Error())
+			return
+		}
+	}
+
 	err = gmodel.SetCallbackFuncGo(mtsp.LPCallbackMTSP, model)
 	if err != nil {
 		mtsp.Log(1, err.Error())
@@ -304,6 +753,296 @@ func solveByBCH(model *mtsp.MTSPModel) {
 	captureSolution(model)
 }
 
+//setSolutionStats computes the makespan, total cost, collected prize and number of used vehicles of the routes
+func setSolutionStats() {
+	sol.UsedVehicles = mtsp.UsedVehicles(sol.Routes)
+	sol.Makespan = 0
+	sol.TotalCost = 0
+	sol.Prize = 0
+	for i := 0; i < len(sol.Routes) && pInst.Prices != nil; i++ {
+		for j := 0; j < len(sol.Routes[i]); j++ {
+			sol.Prize += pInst.Prices[sol.Routes[i][j]]
+		}
+	}
+	for i := 0; i < len(sol.RouteCosts); i++ {
+		sol.TotalCost += sol.RouteCosts[i]
+		if sol.RouteCosts[i] > sol.Makespan {
+			sol.Makespan = sol.RouteCosts[i]
+		}
+	}
+}
+
+//solveBySP minimizes the makespan with the set-partitioning master model
+func solveBySP(env *gurobi.Env) {
+	defer writeSolution()
+	startTime := time.Now()
+	routes, lBound, proven, err := mtsp.SolveSP(env, &pInst, edgeDist)
+	sol.Time = time.Since(startTime).String()
+	mtsp.Log(2, "\n---OPTIMIZATION DONE---\n")
+	if err != nil {
+		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+		sol.Comment += fmt.Sprintf("The set-partitioning model stopped with an error: %s. ", err.Error())
+	}
+	sol.LBound = lBound
+	if !proven {
+		sol.Comment += "The pricing could not prove, that no improving column is missing, so the bisection stopped before closing the gap. "
+	}
+	if routes == nil {
+		if err == nil && proven {
+			mtsp.Log(1, "Model for %s is infeasible\n", *inputF)
+			sol.Infeasible = true
+			sol.Comment += "The instance is infeasible: no assignment of the nodes to the vehicles satisfies all constraints. "
+		}
+		return
+	}
+	sol.Routes = routes
+	sol.RouteCosts = nil
+	for i := 0; i < len(routes); i++ {
+		sol.RouteCosts = append(sol.RouteCosts, pInst.RouteCost(i, routes[i], edgeDist))
+	}
+	setSolutionStats()
+	sol.Obj = sol.Makespan
+	sol.UBound = sol.Obj
+	sol.Optimal = err == nil && proven && sol.LBound >= sol.Obj
+	mtsp.Log(2, "Found Tours with CMax %d : %v \n", sol.Obj, sol.Routes)
+}
+
+//solveByLNS improves the solution of the insertion heuristic by the large neighbourhood search
+func solveByLNS(env *gurobi.Env, obj mtsp.MTSPObjective, bounds int8) {
+	defer writeSolution()
+	params := mtsp.LNSParams{Iterations: *lnsIterations, TimeLimit: time.Duration(*lnsTime) * time.Second, DestroyVehicles: *lnsVehicles, DestroyNodes: *lnsNodes,
+		Reaction: *lnsReaction, Seed: *lnsSeed, MasterModel: *masterModel, SubtourIneq: *subtourIneq, YType: bounds, Cuts: cuts}
+	startTime := time.Now()
+	routes, objVal, err := mtsp.SolveLNS(env, &pInst, edgeDist, obj, params)
+	sol.Time = time.Since(startTime).String()
+	mtsp.Log(2, "\n---OPTIMIZATION DONE---\n")
+	if err != nil {
+		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+		sol.Comment += fmt.Sprintf("The LNS stopped with an error: %s. ", err.Error())
+	}
+	if routes == nil {
+		return
+	}
+	sol.Routes = routes
+	sol.RouteCosts = nil
+	for i := 0; i < len(routes); i++ {
+		sol.RouteCosts = append(sol.RouteCosts, pInst.RouteCost(i, routes[i], edgeDist))
+	}
+	setSolutionStats()
+	sol.Obj = objVal
+	sol.UBound = sol.Obj
+	if *objective == mtsp.OBJ_MAKESPAN {
+		sol.LBound = sol.CMaxLBound
+		sol.Optimal = sol.LBound >= sol.Obj
+	}
+	mtsp.Log(2, "Found Tours with objective %d : %v \n", sol.Obj, sol.Routes)
+}
+
+//portfolioConfig is one configuration of the portfolio
+type portfolioConfig struct {
+	name        string
+	masterModel string
+	cuts        mtsp.ArrayStringFlags
+	yBounds     int8
+}
+
+//portfolioResult is the outcome of the run of a configuration
+type portfolioResult struct {
+	config  portfolioConfig
+	status  int32
+	lBound  float64
+	stopped bool
+	err     error
+}
+
+//parsePortfolio parses the configurations model:cuts:yBounds separated by semicolons, the cuts are separated by commas
+func parsePortfolio(spec string) ([]portfolioConfig, error) {
+	configs := make([]portfolioConfig, 0)
+	for _, c := range strings.Split(spec, ";") {
+		parts := strings.Split(c, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("the portfolio configuration %s is not of the form model:cuts:yBounds", c)
+		}
+		if parts[0] != mtsp.MASTERMODEL_TSP && parts[0] != mtsp.MASTERMODEL_ATSP {
+			return nil, fmt.Errorf("the portfolio only supports the %s and %s models, not %s", mtsp.MASTERMODEL_TSP, mtsp.MASTERMODEL_ATSP, parts[0])
+		}
+		config := portfolioConfig{name: c, masterModel: parts[0], yBounds: gurobi.BINARY}
+		if parts[2] == mtsp.Y_BOUNDS_CONT {
+			config.yBounds = gurobi.CONTINUOUS
+		}
+		for _, cut := range strings.Split(parts[1], ",") {
+			if cut != "" {
+				config.cuts.Set(cut)
+			}
+		}
+		configs = append(configs, config)
+	}
+	return configs, nil
+}
+
+//solvePortfolio runs the configurations of -portfolio concurrently with the BCH strategy, sharing their incumbent,
+//until one of them proves optimality or all of them stop
+func solvePortfolio(obj mtsp.MTSPObjective) {
+	defer writeSolution()
+	configs, err := parsePortfolio(*portfolio)
+	if err != nil {
+		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+		return
+	}
+	shared := mtsp.NewSharedIncumbent(obj)
+	results := make(chan portfolioResult, len(configs))
+	startTime := time.Now()
+	for c := 0; c < len(configs); c++ {
+		go func(c int) {
+			results <- runPortfolioConfig(c, configs[c], obj, shared)
+		}(c)
+	}
+	bestBound := math.Inf(-1)
+	if obj.Prize {
+		bestBound = math.Inf(1)
+	}
+	for c := 0; c < len(configs); c++ {
+		res := <-results
+		if res.err != nil {
+			mtsp.Log(1, "Portfolio: the run %s failed: %s\n", res.config.name, res.err.Error())
+			continue
+		}
+		if res.stopped {
+			//the bound of a stopped run is still valid
+			mtsp.Log(2, "Portfolio: the run %s was stopped", res.config.name)
+		}
+		if res.status == gurobi.OPTIMAL || res.status == gurobi.INFEASIBLE || res.status == gurobi.INF_OR_UNBD {
+			shared.Finish(res.config.name)
+			if shared.Winner() == res.config.name {
+				sol.Infeasible = res.status != gurobi.OPTIMAL
+			}
+		}
+		if (!obj.Prize && res.lBound > bestBound) || (obj.Prize && res.lBound < bestBound) {
+			bestBound = res.lBound
+		}
+	}
+	sol.Time = time.Since(startTime).String()
+	mtsp.Log(2, "\n---OPTIMIZATION DONE---\n")
+
+	objVal, routes, routeCosts, source := shared.Best()
+	sol.PortfolioWinner = shared.Winner()
+	if sol.PortfolioWinner == "" {
+		sol.PortfolioWinner = source
+	}
+	sol.Comment += fmt.Sprintf("Portfolio of %d configurations, won by %s. ", len(configs), sol.PortfolioWinner)
+	if sol.Infeasible {
+		sol.Comment += "The instance is infeasible: no assignment of the nodes to the vehicles satisfies all constraints. "
+		return
+	}
+	if routes == nil {
+		return
+	}
+	sol.Routes = routes
+	sol.RouteCosts = routeCosts
+	setSolutionStats()
+	sol.Obj = objVal
+	if obj.Prize {
+		sol.LBound = sol.Obj
+		if !math.IsInf(bestBound, 1) {
+			sol.UBound = int(bestBound + 0.5)
+		}
+	} else {
+		sol.UBound = sol.Obj
+		if !math.IsInf(bestBound, -1) {
+			sol.LBound = int(bestBound + 0.5)
+		}
+	}
+	sol.Optimal = shared.Winner() != "" && sol.LBound == sol.UBound
+	mtsp.Log(2, "Found Tours with objective %d by %s: %v \n", sol.Obj, sol.PortfolioWinner, sol.Routes)
+}
+
+//runPortfolioConfig solves the model of the configuration with its own gurobi environment
+func runPortfolioConfig(c int, config portfolioConfig, obj mtsp.MTSPObjective, shared *mtsp.SharedIncumbent) (res portfolioResult) {
+	res.config = config
+	env, err := gurobi.LoadEnv(fmt.Sprintf("hmmVRP_%d.log", c))
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer env.Free()
+	model, err := mtsp.CreateMTSPModel(env, &pInst, edgeDist, gurobi.BINARY, config.yBounds, config.masterModel, *subtourIneq, candidateEdges, obj)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer model.GModel.Free()
+	setLowerBound(&model)
+	fixVariables(&model)
+	model.GCuts = config.cuts
+	model.LocalSearch = *localSearch
+	model.Shared = shared
+	model.Name = config.name
+	/* Must set LazyConstraints parameter when using lazy constraints */
+	err = model.GModel.SetIntParam(gurobi.INT_PAR_LAZYCONSTRAINTS, 1)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	err = model.GModel.SetCallbackFuncGo(mtsp.BCHCallbackMTSP, &model)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	err = model.GModel.Optimize()
+	if err != nil {
+		res.err = err
+		return res
+	}
+	res.status, err = model.GModel.GetIntAttr(gurobi.INT_ATTR_STATUS)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	//the callback terminates the optimization, when another run has finished
+	res.stopped = res.status == gurobi.INTERRUPTED
+	if res.status == gurobi.OPTIMAL || res.status == gurobi.TIME_LIMIT || res.stopped {
+		res.lBound, err = model.GModel.GetDblAttr(gurobi.DBL_ATTR_OBJBOUND)
+		if err != nil {
+			res.err = err
+			return res
+		}
+	}
+	if res.status == gurobi.OPTIMAL || res.status == gurobi.INFEASIBLE || res.status == gurobi.INF_OR_UNBD {
+		//stop the other runs
+		shared.Finish(config.name)
+	}
+	mtsp.Log(2, "Portfolio: the run %s ended with status %d", config.name, res.status)
+	return res
+}
+
+//solveByClusters clusters the nodes into one region per vehicle, routes and rebalances them heuristically
+func solveByClusters(obj mtsp.MTSPObjective) {
+	defer writeSolution()
+	startTime := time.Now()
+	routes, err := mtsp.SolveClusterFirst(&pInst, edgeDist, *rebalanceMoves)
+	sol.Time = time.Since(startTime).String()
+	mtsp.Log(2, "\n---OPTIMIZATION DONE---\n")
+	if err != nil {
+		mtsp.Log(1, "At %s: %s\n", *inputF, err.Error())
+		sol.Comment += fmt.Sprintf("The cluster-first decomposition stopped with an error: %s. ", err.Error())
+		return
+	}
+	sol.Routes = routes
+	sol.RouteCosts = nil
+	for i := 0; i < len(routes); i++ {
+		sol.RouteCosts = append(sol.RouteCosts, pInst.RouteCost(i, routes[i], edgeDist))
+	}
+	setSolutionStats()
+	sol.Obj = pInst.ObjectiveValue(routes, edgeDist, obj)
+	sol.UBound = sol.Obj
+	if *objective == mtsp.OBJ_MAKESPAN {
+		sol.LBound = sol.CMaxLBound
+		sol.Optimal = sol.LBound >= sol.Obj
+	}
+	sol.Comment += "Heuristic cluster-first route-second solution. "
+	mtsp.Log(2, "Found Tours with objective %d : %v \n", sol.Obj, sol.Routes)
+}
+
 func writeSolution() {
 	jsonInst, err := json.MarshalIndent(pInst, "", "\t")
 	if err != nil {
@@ -0,0 +1,641 @@
+package mtsp
+
+import (
+	"fmt"
+	"math"
+
+	"git.solver4all.com/azaryc2s/gorobi/gurobi"
+)
+
+/* Set-partitioning master model, minimizing the makespan by bisection over the route length bound T and branch-and-price for each T. */
+
+const (
+	spEps        = 1e-6
+	spPriceScale = 1000.0 //scale of the duals in the exact pricing, whose callback compares its heuristic solutions by the rounded values
+	spAttrPi     = "Pi"   //dual values of the constraints
+)
+
+//spColumn is a feasible route of a vehicle type
+type spColumn struct {
+	vType int
+	route []int
+	cost  int
+}
+
+//spBranch keeps the nodes J and K on the same route (Together) or on different ones.
+//If K < 0, it forces node J to be served by vehicle type Type (Together) or forbids it
+type spBranch struct {
+	J, K     int
+	Type     int
+	Together bool
+}
+
+type spSolver struct {
+	env      *gurobi.Env
+	inst     *MTSPInstance
+	d        [][]int
+	N        int
+	types    [][]int //vehicles of each type, the first one represents the type
+	optional bool
+	columns  []spColumn
+	seen     map[string]bool
+}
+
+//SolveSP minimizes the makespan with the set-partitioning master model and returns the routes of all vehicles and the lower bound.
+//proven is false, if the pricing could not prove some makespan infeasible, then the bisection stopped early.
+//routes is nil if the instance has no feasible solution, which is only certain if proven is true
+func SolveSP(gurobiEnv *gurobi.Env, inst *MTSPInstance, d [][]int) (routes [][]int, lBound int, proven bool, err error) {
+	sp := spSolver{env: gurobiEnv, inst: inst, d: d, N: len(d), types: inst.VehicleTypes(len(d)), optional: inst.HasOptionalVehicles(), seen: make(map[string]bool)}
+	Log(2, "Set-partitioning master with %d vehicle types", len(sp.types))
+
+	//each node has to be served by some vehicle on a route of its own at least
+	lo := 0
+	for j := 1; j < sp.N; j++ {
+		min := -1
+		for i := 0; i < len(inst.TravelSpeeds); i++ {
+			length, inTime := inst.RouteSchedule(i, []int{0, j}, d)
+			if inTime && inst.IsAllowed(i, j) && (min < 0 || length < min) {
+				min = length
+			}
+		}
+		if min > lo {
+			lo = min
+		}
+	}
+	hi := sp.maxRouteLength()
+
+	routes, proven, err = sp.solveAt(hi)
+	if err != nil || routes == nil {
+		return nil, lo, proven, err
+	}
+	hi = sp.makespan(routes)
+	for lo < hi {
+		T := (lo + hi) / 2
+		Log(2, "Set-partitioning: searching a solution with makespan at most %d, bounds [%d,%d]", T, lo, hi)
+		found, isProven, err := sp.solveAt(T)
+		if err != nil {
+			return routes, lo, false, err
+		}
+		if found == nil && !isProven {
+			Log(2, "Set-partitioning: the pricing could not prove, that there is no solution with makespan at most %d, stopping with the bounds [%d,%d]", T, lo, hi)
+			return routes, lo, false, nil
+		}
+		if found == nil {
+			lo = T + 1
+			continue
+		}
+		routes = found
+		hi = sp.makespan(routes)
+		Log(2, "Set-partitioning: found a solution with makespan %d", hi)
+	}
+	return routes, lo, true, nil
+}
+
+//makespan returns the length of the longest route
+func (sp *spSolver) makespan(routes [][]int) int {
+	makespan := 0
+	for i := 0; i < len(routes); i++ {
+		if cost := sp.inst.RouteCost(i, routes[i], sp.d); cost > makespan {
+			makespan = cost
+		}
+	}
+	return makespan
+}
+
+//maxRouteLength returns an upper bound on the length of any route
+func (sp *spSolver) maxRouteLength() int {
+	if sp.inst.TimeWindows != nil {
+		return sp.inst.TimeWindows[0][1] - sp.inst.TimeWindows[0][0]
+	}
+	bound := 0
+	for i := 0; i < len(sp.inst.TravelSpeeds); i++ {
+		path := 0
+		for j := 0; j < sp.N; j++ {
+			max := 0
+			for k := 0; k < sp.N; k++ {
+				if sp.d[j][k] > max {
+					max = sp.d[j][k]
+				}
+			}
+			path += max*sp.inst.TravelSpeeds[i] + sp.inst.ServiceTime(i, j)
+		}
+		if path > bound {
+			bound = path
+		}
+	}
+	return bound
+}
+
+//solveAt searches an integer solution with routes not longer than T by branch-and-price and returns the routes of all vehicles,
+//or nil if there is none. proven is false, if some node was pruned without the pricing proving it infeasible
+func (sp *spSolver) solveAt(T int) (routes [][]int, proven bool, err error) {
+	open := [][]spBranch{{}}
+	nodes := 0
+	proven = true
+	for len(open) > 0 {
+		branches := open[len(open)-1]
+		open = open[:len(open)-1]
+		nodes++
+		cols, lambda, slack, isProven, err := sp.columnGeneration(T, branches)
+		if err != nil {
+			return nil, false, err
+		}
+		if slack > spEps {
+			if isProven {
+				Log(3, "Branch-and-price node %d with %d branches is infeasible", nodes, len(branches))
+			} else {
+				Log(3, "Branch-and-price node %d with %d branches has slack, but the pricing could not prove it infeasible", nodes, len(branches))
+				proven = false
+			}
+			continue
+		}
+		branch, isFractional := sp.branchingDecision(cols, lambda)
+		if !isFractional {
+			Log(3, "Branch-and-price found an integer solution after %d nodes", nodes)
+			return sp.extractRoutes(cols, lambda), true, nil
+		}
+		Log(3, "Branch-and-price node %d is fractional, branching on %v", nodes, branch)
+		separate := append(append([]spBranch{}, branches...), spBranch{J: branch.J, K: branch.K, Type: branch.Type, Together: false})
+		together := append(append([]spBranch{}, branches...), spBranch{J: branch.J, K: branch.K, Type: branch.Type, Together: true})
+		open = append(open, separate, together)
+	}
+	return nil, proven, nil
+}
+
+//columnGeneration solves the restricted master LP of a branch-and-price node and adds columns until none has a negative reduced cost.
+//It returns the used columns, their values and the remaining slack, which is 0 if the node is feasible.
+//proven is false, if the exact pricing could not prove, that no column with a negative reduced cost is missing
+func (sp *spSolver) columnGeneration(T int, branches []spBranch) (cols []int, lambda []float64, slack float64, proven bool, err error) {
+	for {
+		cols = make([]int, 0)
+		for c := 0; c < len(sp.columns); c++ {
+			if sp.columns[c].cost <= T && sp.isCompatible(sp.columns[c], branches) {
+				cols = append(cols, c)
+			}
+		}
+		var pi []float64
+		lambda, pi, slack, err = sp.solveMaster(cols)
+		if err != nil {
+			return nil, nil, 0, false, err
+		}
+		if slack <= spEps {
+			//the node is feasible, more columns can not improve it
+			return cols, lambda, slack, true, nil
+		}
+		added := 0
+		for t := 0; t < len(sp.types); t++ {
+			added += sp.priceHeuristically(t, T, branches, pi)
+		}
+		proven = true
+		for t := 0; t < len(sp.types) && added == 0; t++ {
+			n, isProven, err := sp.priceExactly(t, T, branches, pi)
+			if err != nil {
+				return nil, nil, 0, false, err
+			}
+			added += n
+			proven = proven && isProven
+		}
+		Log(4, "Column generation: slack %.4f, added %d columns", slack, added)
+		if added == 0 {
+			return cols, lambda, slack, proven, nil
+		}
+	}
+}
+
+//solveMaster solves the restricted master LP over the given columns and returns their values, the duals of the constraints and the total slack
+func (sp *spSolver) solveMaster(cols []int) (lambda []float64, pi []float64, slack float64, err error) {
+	N := sp.N
+	K := len(sp.types)
+	//slacks of the covering constraints, slacks of the type constraints and the columns
+	varCount := (N - 1) + K + len(cols)
+	objFun := make([]float64, varCount)
+	varType := make([]int8, varCount)
+	varNames := make([]string, varCount)
+	for j := 1; j < N; j++ {
+		objFun[j-1] = 1.0
+		varType[j-1] = gurobi.CONTINUOUS
+		varNames[j-1] = fmt.Sprintf("S_%d", j)
+	}
+	for t := 0; t < K; t++ {
+		//unused vehicles violate the model only if all vehicles have to be used
+		if !sp.optional {
+			objFun[N-1+t] = 1.0
+		}
+		varType[N-1+t] = gurobi.CONTINUOUS
+		varNames[N-1+t] = fmt.Sprintf("U_%d", t)
+	}
+	cStart := N - 1 + K
+	for c := 0; c < len(cols); c++ {
+		varType[cStart+c] = gurobi.CONTINUOUS
+		varNames[cStart+c] = fmt.Sprintf("L_%d", cols[c])
+	}
+	model, err := sp.env.NewModel("sp", int32(varCount), objFun, nil, nil, varType, varNames)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer model.Free()
+	err = model.SetIntParam("OutputFlag", 0)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	//Add the covering constraints S_j + sum_r(a_jr*L_r) = 1
+	for j := 1; j < N; j++ {
+		ind := []int32{int32(j - 1)}
+		val := []float64{1.0}
+		for c := 0; c < len(cols); c++ {
+			if sp.columns[cols[c]].visits(j) {
+				ind = append(ind, int32(cStart+c))
+				val = append(val, 1.0)
+			}
+		}
+		err = model.AddConstr(ind, val, gurobi.EQUAL, 1.0, fmt.Sprintf("COVER_%d", j))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	//Add the type constraints U_t + sum_{r of type t}(L_r) = m_t
+	for t := 0; t < K; t++ {
+		ind := []int32{int32(N - 1 + t)}
+		val := []float64{1.0}
+		for c := 0; c < len(cols); c++ {
+			if sp.columns[cols[c]].vType == t {
+				ind = append(ind, int32(cStart+c))
+				val = append(val, 1.0)
+			}
+		}
+		err = model.AddConstr(ind, val, gurobi.EQUAL, float64(len(sp.types[t])), fmt.Sprintf("TYPE_%d", t))
+		if err != nil {
+			return nil, nil, 0, err
+		}
+	}
+
+	constrCount := N - 1 + K
+	if sp.inst.MaxVehicles > 0 {
+		//Add the constraint sum_r(L_r) <= maxVehicles
+		ind := make([]int32, 0)
+		val := make([]float64, 0)
+		for c := 0; c < len(cols); c++ {
+			ind = append(ind, int32(cStart+c))
+			val = append(val, 1.0)
+		}
+		err = model.AddConstr(ind, val, gurobi.LESS_EQUAL, float64(sp.inst.MaxVehicles), "VEH_MAX")
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		constrCount++
+	}
+
+	err = model.Optimize()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	slack, err = model.GetDblAttr(gurobi.DBL_ATTR_OBJVAL)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	x, err := model.GetDblAttrArray(gurobi.DBL_ATTR_X, 0, int32(varCount))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	pi, err = model.GetDblAttrArray(spAttrPi, 0, int32(constrCount))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return x[cStart:], pi, slack, nil
+}
+
+//typeDual returns the sum of the duals of the constraints on the number of vehicles, that a column of vehicle type t is part of
+func (sp *spSolver) typeDual(t int, pi []float64) float64 {
+	dual := pi[sp.N-1+t]
+	if sp.inst.MaxVehicles > 0 {
+		dual += pi[sp.N-1+len(sp.types)]
+	}
+	return dual
+}
+
+//reducedCost returns the reduced cost of the route for vehicle type t. Only the slacks have costs, so it is the negated sum of the duals
+func (sp *spSolver) reducedCost(t int, route []int, pi []float64) float64 {
+	rc := -sp.typeDual(t, pi)
+	for j := 1; j < len(route); j++ {
+		rc -= pi[route[j]-1]
+	}
+	return rc
+}
+
+//addColumn adds the route for vehicle type t, if it is new and has a negative reduced cost
+func (sp *spSolver) addColumn(t int, route []int, pi []float64) bool {
+	key := fmt.Sprintf("%d:%v", t, route)
+	if sp.seen[key] || sp.reducedCost(t, route, pi) > -spEps {
+		return false
+	}
+	sp.seen[key] = true
+	sp.columns = append(sp.columns, spColumn{vType: t, route: route, cost: sp.inst.RouteCost(sp.types[t][0], route, sp.d)})
+	Log(4, "Added column %v for vehicle type %d with reduced cost %.4f", route, t, sp.reducedCost(t, route, pi))
+	return true
+}
+
+//isForbidden reports whether vehicle type t may not serve node j in the current branch
+func (sp *spSolver) isForbidden(t int, j int, branches []spBranch) bool {
+	if !sp.inst.IsAllowed(sp.types[t][0], j) {
+		return true
+	}
+	for _, b := range branches {
+		if b.K < 0 && b.J == j && (b.Type == t) != b.Together {
+			return true
+		}
+	}
+	return false
+}
+
+//isCompatible reports whether the column respects all branching decisions
+func (sp *spSolver) isCompatible(col spColumn, branches []spBranch) bool {
+	for _, b := range branches {
+		if b.K < 0 {
+			if col.visits(b.J) && (b.Type == col.vType) != b.Together {
+				return false
+			}
+		} else if b.Together && col.visits(b.J) != col.visits(b.K) {
+			return false
+		} else if !b.Together && col.visits(b.J) && col.visits(b.K) {
+			return false
+		}
+	}
+	return true
+}
+
+//isFeasible reports whether the route can be driven by vehicle type t within T
+func (sp *spSolver) isFeasible(t int, route []int, T int) bool {
+	v := sp.types[t][0]
+	if sp.inst.IsCapacitated() && sp.inst.RouteLoad(route) > sp.inst.Capacities[v] {
+		return false
+	}
+	length, inTime := sp.inst.RouteSchedule(v, route, sp.d)
+	if limit := sp.inst.MaxDuration(v); limit > 0 && length > limit {
+		return false
+	}
+	return inTime && length <= T
+}
+
+//priceHeuristically builds a route for vehicle type t by inserting the nodes with the best ratio of their dual value
+//and the increase of the route length, as long as the route stays within T. Returns the number of added columns
+func (sp *spSolver) priceHeuristically(t int, T int, branches []spBranch, pi []float64) int {
+	v := sp.types[t][0]
+	route := []int{0}
+	for {
+		bestRoute := []int(nil)
+		bestRatio := 0.0
+		length := sp.inst.RouteCost(v, route, sp.d)
+		for j := 1; j < sp.N; j++ {
+			if pi[j-1] <= spEps || sp.isForbidden(t, j, branches) || contains(route, j) {
+				continue
+			}
+			for p := 1; p <= len(route); p++ {
+				cand := make([]int, 0, len(route)+1)
+				cand = append(cand, route[:p]...)
+				cand = append(cand, j)
+				cand = append(cand, route[p:]...)
+				if !sp.isFeasible(t, cand, T) {
+					continue
+				}
+				ratio := pi[j-1] / math.Max(1.0, float64(1+sp.inst.RouteCost(v, cand, sp.d)-length))
+				if ratio > bestRatio {
+					bestRatio = ratio
+					bestRoute = cand
+				}
+			}
+		}
+		if bestRoute == nil {
+			break
+		}
+		route = bestRoute
+	}
+	if len(route) < 2 || !sp.isCompatible(spColumn{vType: t, route: route}, branches) {
+		return 0
+	}
+	if sp.addColumn(t, route, pi) {
+		return 1
+	}
+	return 0
+}
+
+//priceExactly solves the pricing problem of vehicle type t with the prize-collecting master model, whose objective are the duals of the nodes.
+//A column has a negative reduced cost iff the duals of its nodes and of its type sum up to more than 0.
+//Returns the number of added columns and whether the pricing proved, that there is no column with a negative reduced cost
+func (sp *spSolver) priceExactly(t int, T int, branches []spBranch, pi []float64) (added int, proven bool, err error) {
+	v := sp.types[t][0]
+	sub := sp.inst.vehicleInstance(v, sp.N)
+	sub.TMax = T
+	if limit := sp.inst.MaxDuration(v); limit > 0 && limit < T {
+		sub.TMax = limit
+	}
+	//the callback compares the heuristic solutions by the integer prices, gurobi optimizes the exact duals
+	sub.Prices = make([]int, sp.N)
+	weights := make([]float64, sp.N)
+	typeDual := sp.typeDual(t, pi)
+	maxPrize := 0.0
+	for j := 1; j < sp.N; j++ {
+		if sp.isForbidden(t, j, branches) {
+			//no vehicle may serve the node in the subproblem
+			sub.AllowedVehicles[j] = []int{-1}
+			continue
+		}
+		weights[j] = pi[j-1] * spPriceScale
+		sub.Prices[j] = int(math.Round(weights[j]))
+		maxPrize += math.Max(pi[j-1], 0.0)
+	}
+	if maxPrize+typeDual <= spEps {
+		//even serving all nodes with a positive dual would not yield a negative reduced cost
+		return 0, true, nil
+	}
+
+	model, err := createMTSPModel(sp.env, &sub, sp.d, gurobi.BINARY, gurobi.CONTINUOUS, MASTERMODEL_TSP, "", nil, MTSPObjective{Prize: true, PrizeWeights: weights}, true)
+	if err != nil {
+		return 0, false, err
+	}
+	defer model.GModel.Free()
+	//a column serves at least one node, otherwise staying at the depot would hide the columns with negative prizes
+	ind := make([]int32, 0, sp.N-1)
+	val := make([]float64, 0, sp.N-1)
+	for j := 1; j < sp.N; j++ {
+		ind = append(ind, int32(GetNodeIndex(0, j, sp.N, model.XStart)))
+		val = append(val, 1.0)
+	}
+	err = model.GModel.AddConstr(ind, val, gurobi.GREATER_EQUAL, 1.0, "SP_NONEMPTY")
+	if err != nil {
+		return 0, false, err
+	}
+	for _, b := range branches {
+		if b.K < 0 {
+			continue
+		}
+		ind := []int32{int32(GetNodeIndex(0, b.J, sp.N, model.XStart)), int32(GetNodeIndex(0, b.K, sp.N, model.XStart))}
+		if b.Together {
+			err = model.GModel.AddConstr(ind, []float64{1.0, -1.0}, gurobi.EQUAL, 0.0, fmt.Sprintf("BR_%d_%d", b.J, b.K))
+		} else {
+			err = model.GModel.AddConstr(ind, []float64{1.0, 1.0}, gurobi.LESS_EQUAL, 1.0, fmt.Sprintf("BR_%d_%d", b.J, b.K))
+		}
+		if err != nil {
+			return 0, false, err
+		}
+	}
+	//the no-good cuts bound the route length by the optimal tour through the assigned nodes, so TMAX limits the real routes
+	model.GCuts = ArrayStringFlags{CUT_NOGOOD}
+	err = model.GModel.SetIntParam("OutputFlag", 0)
+	if err != nil {
+		return 0, false, err
+	}
+	err = model.GModel.SetIntParam(gurobi.INT_PAR_LAZYCONSTRAINTS, 1)
+	if err != nil {
+		return 0, false, err
+	}
+	err = model.GModel.SetCallbackFuncGo(BCHCallbackMTSP, &model)
+	if err != nil {
+		return 0, false, err
+	}
+	err = model.GModel.Optimize()
+	if err != nil {
+		return 0, false, err
+	}
+	status, err := model.GModel.GetIntAttr(gurobi.INT_ATTR_STATUS)
+	if err != nil {
+		return 0, false, err
+	}
+	if status == gurobi.INFEASIBLE || status == gurobi.INF_OR_UNBD {
+		//no single node can be served within T
+		return 0, true, nil
+	}
+	if status == gurobi.OPTIMAL {
+		bound, err := model.GModel.GetDblAttr(gurobi.DBL_ATTR_OBJBOUND)
+		if err != nil {
+			return 0, false, err
+		}
+		proven = bound/spPriceScale+typeDual <= spEps
+	}
+	for _, route := range sp.pricedRoutes(&model, t, T) {
+		if sp.isCompatible(spColumn{vType: t, route: route}, branches) && sp.addColumn(t, route, pi) {
+			added++
+		}
+	}
+	return added, proven, nil
+}
+
+//pricedRoutes returns the route of the incumbent of the pricing model and the best route of its callback, if they are feasible within T
+func (sp *spSolver) pricedRoutes(model *MTSPModel, t int, T int) [][]int {
+	routes := make([][]int, 0, 2)
+	x, err := model.GModel.GetDblAttrArray(gurobi.DBL_ATTR_X, int32(GetNodeIndex(0, 0, sp.N, model.XStart)), int32(sp.N))
+	if err == nil {
+		indx := []int{0}
+		for j := 1; j < sp.N; j++ {
+			if x[j] > 0.5 {
+				indx = append(indx, j)
+			}
+		}
+		if len(indx) > 1 {
+			tour, _, _, isFeasible, err := model.solveSubproblem(0, indx)
+			if err == nil && isFeasible && tour != nil {
+				route := make([]int, len(tour))
+				for k := 0; k < len(tour); k++ {
+					route[k] = indx[tour[k]]
+				}
+				routes = append(routes, route)
+			}
+		}
+	}
+	if model.BestSol.Routes != nil && len(model.BestSol.Routes[0]) > 1 {
+		routes = append(routes, model.BestSol.Routes[0])
+	}
+	feasible := routes[:0]
+	for _, route := range routes {
+		if sp.isFeasible(t, route, T) {
+			feasible = append(feasible, route)
+		}
+	}
+	return feasible
+}
+
+//branchingDecision returns a pair of nodes, that is served together only partially by the master solution,
+//or a node, that is served by some vehicle type only partially. isFractional is false, if there is neither
+func (sp *spSolver) branchingDecision(cols []int, lambda []float64) (branch spBranch, isFractional bool) {
+	N := sp.N
+	together := make([][]float64, N)
+	byType := make([][]float64, N)
+	for j := 0; j < N; j++ {
+		together[j] = make([]float64, N)
+		byType[j] = make([]float64, len(sp.types))
+	}
+	for c := 0; c < len(cols); c++ {
+		if lambda[c] <= spEps {
+			continue
+		}
+		col := sp.columns[cols[c]]
+		for a := 1; a < len(col.route); a++ {
+			byType[col.route[a]][col.vType] += lambda[c]
+			for b := a + 1; b < len(col.route); b++ {
+				together[col.route[a]][col.route[b]] += lambda[c]
+				together[col.route[b]][col.route[a]] += lambda[c]
+			}
+		}
+	}
+	//branch on the value closest to 0.5
+	best := 1.0
+	for j := 1; j < N; j++ {
+		for k := j + 1; k < N; k++ {
+			if f := math.Abs(together[j][k] - 0.5); together[j][k] > spEps && together[j][k] < 1-spEps && f < best {
+				best = f
+				branch = spBranch{J: j, K: k}
+				isFractional = true
+			}
+		}
+	}
+	if isFractional {
+		return branch, true
+	}
+	for j := 1; j < N; j++ {
+		for t := 0; t < len(sp.types); t++ {
+			if f := math.Abs(byType[j][t] - 0.5); byType[j][t] > spEps && byType[j][t] < 1-spEps && f < best {
+				best = f
+				branch = spBranch{J: j, K: -1, Type: t}
+				isFractional = true
+			}
+		}
+	}
+	return branch, isFractional
+}
+
+//extractRoutes assigns the columns of an integer master solution to the vehicles of their types.
+//Columns visiting the same nodes are interchangeable, so only the first one of them is used
+func (sp *spSolver) extractRoutes(cols []int, lambda []float64) [][]int {
+	routes := make([][]int, len(sp.inst.TravelSpeeds))
+	for i := 0; i < len(routes); i++ {
+		routes[i] = []int{}
+	}
+	covered := make([]bool, sp.N)
+	used := make([]int, len(sp.types))
+	for c := 0; c < len(cols); c++ {
+		col := sp.columns[cols[c]]
+		if lambda[c] <= spEps || covered[col.route[1]] || used[col.vType] >= len(sp.types[col.vType]) {
+			continue
+		}
+		for j := 1; j < len(col.route); j++ {
+			covered[col.route[j]] = true
+		}
+		routes[sp.types[col.vType][used[col.vType]]] = col.route
+		used[col.vType]++
+	}
+	return routes
+}
+
+//visits reports whether the route of the column visits node j
+func (col spColumn) visits(j int) bool {
+	return contains(col.route, j)
+}
+
+func contains(route []int, j int) bool {
+	for _, n := range route {
+		if n == j {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,184 @@
+package mtsp
+
+import (
+	"fmt"
+	"git.solver4all.com/azaryc2s/gorobi/gurobi"
+)
+
+/* Solves the travelling salesman problem with time windows tw and service times st on the speed-scaled distance matrix d,
+starting at node 0 and waiting for windows not yet open. isFeasible is false if no tour exists. */
+
+func SolveTSPTW(d [][]int, st []int, tw [][]int, gurobiEnv *gurobi.Env) (tour []int, length int, isFeasible bool, err error) {
+	n := len(d)
+	if n <= 2 {
+		tour = make([]int, n)
+		for j := 0; j < n; j++ {
+			tour[j] = j
+		}
+		length, isFeasible = ScheduleLength(tour, d, st, tw)
+		return tour, length, isFeasible, nil
+	}
+	//quick check: a node that cannot be reached in time directly from the depot cannot be reached at all
+	for k := 1; k < n; k++ {
+		if tw[0][0]+st[0]+d[0][k] > tw[k][1] {
+			Log(4, "Node %d of the subproblem can not be reached within its time window", k)
+			return nil, -1, false, nil
+		}
+	}
+
+	yStart := 0
+	yCount := n * (n - 1)
+	aStart := yStart + yCount
+	tMax := aStart + n
+	varCount := tMax + 1
+
+	objFun := make([]float64, varCount)
+	lb := make([]float64, varCount)
+	ub := make([]float64, varCount)
+	varType := make([]int8, varCount)
+	varNames := make([]string, varCount)
+	for j := 0; j < n; j++ {
+		for k := 0; k < n; k++ {
+			if k == j {
+				continue
+			}
+			ei := GetEdgeIndex(0, j, k, n, yStart, MASTERMODEL_ATSP)
+			ub[ei] = 1.0
+			varType[ei] = gurobi.BINARY
+			varNames[ei] = fmt.Sprintf("Y_%d_%d", j, k)
+		}
+		lb[aStart+j] = float64(tw[j][0])
+		ub[aStart+j] = float64(tw[j][1])
+		varType[aStart+j] = gurobi.CONTINUOUS
+		varNames[aStart+j] = fmt.Sprintf("A_%d", j)
+	}
+	//the vehicle leaves the depot as early as possible
+	ub[aStart] = lb[aStart]
+	lb[tMax] = float64(tw[0][0])
+	ub[tMax] = float64(tw[0][1])
+	varType[tMax] = gurobi.CONTINUOUS
+	varNames[tMax] = "T"
+	objFun[tMax] = 1.0
+
+	model, err := gurobiEnv.NewModel("tsptw", int32(varCount), objFun, lb, ub, varType, varNames)
+	if err != nil {
+		return nil, -1, false, err
+	}
+	defer model.Free()
+	err = model.SetIntParam("OutputFlag", 0)
+	if err != nil {
+		return nil, -1, false, err
+	}
+
+	for j := 0; j < n; j++ {
+		outInd := make([]int32, 0)
+		inInd := make([]int32, 0)
+		val := make([]float64, 0)
+		for k := 0; k < n; k++ {
+			if k == j {
+				continue
+			}
+			outInd = append(outInd, int32(GetEdgeIndex(0, j, k, n, yStart, MASTERMODEL_ATSP)))
+			inInd = append(inInd, int32(GetEdgeIndex(0, k, j, n, yStart, MASTERMODEL_ATSP)))
+			val = append(val, 1.0)
+		}
+		err = model.AddConstr(outInd, val, gurobi.EQUAL, 1.0, fmt.Sprintf("out_%d", j))
+		if err != nil {
+			return nil, -1, false, err
+		}
+		err = model.AddConstr(inInd, val, gurobi.EQUAL, 1.0, fmt.Sprintf("in_%d", j))
+		if err != nil {
+			return nil, -1, false, err
+		}
+	}
+
+	//A_k >= A_j + st_j + d_jk - M_jk(1-Y_jk), which also eliminates all subtours without the depot
+	for j := 0; j < n; j++ {
+		for k := 0; k < n; k++ {
+			if k == j {
+				continue
+			}
+			ei := GetEdgeIndex(0, j, k, n, yStart, MASTERMODEL_ATSP)
+			ind := []int32{0, int32(aStart + j), int32(ei)}
+			if k == 0 {
+				ind[0] = int32(tMax)
+			} else {
+				ind[0] = int32(aStart + k)
+			}
+			bigM := float64(tw[j][1] + st[j] + d[j][k] - tw[k][0])
+			if k == 0 {
+				bigM = float64(tw[j][1] + st[j] + d[j][k] - tw[0][0])
+			}
+			if bigM < 0 {
+				bigM = 0
+			}
+			val := []float64{1.0, -1.0, -bigM}
+			err = model.AddConstr(ind, val, gurobi.GREATER_EQUAL, float64(st[j]+d[j][k])-bigM, fmt.Sprintf("time_%d_%d", j, k))
+			if err != nil {
+				return nil, -1, false, err
+			}
+		}
+	}
+
+	err = model.Optimize()
+	if err != nil {
+		return nil, -1, false, err
+	}
+	status, err := model.GetIntAttr(gurobi.INT_ATTR_STATUS)
+	if err != nil {
+		return nil, -1, false, err
+	}
+	if status == gurobi.INFEASIBLE || status == gurobi.INF_OR_UNBD {
+		return nil, -1, false, nil
+	}
+	sol, err := model.GetDblAttrArray(gurobi.DBL_ATTR_X, 0, int32(varCount))
+	if err != nil {
+		return nil, -1, false, err
+	}
+	tour = []int{0}
+	for next := 0; len(tour) < n; {
+		for k := 0; k < n; k++ {
+			if k != next && sol[GetEdgeIndex(0, next, k, n, yStart, MASTERMODEL_ATSP)] > 0.5 {
+				next = k
+				break
+			}
+		}
+		if next == 0 {
+			break
+		}
+		tour = append(tour, next)
+	}
+	length, isFeasible = ScheduleLength(tour, d, st, tw)
+	return tour, length, isFeasible, nil
+}
+
+//ScheduleLength returns the duration of the closed tour when every node is served as early as possible
+//and whether all time windows are met. tw may be nil.
+func ScheduleLength(tour []int, d [][]int, st []int, tw [][]int) (int, bool) {
+	if len(tour) == 0 {
+		return 0, true
+	}
+	start := 0
+	if tw != nil {
+		start = tw[tour[0]][0]
+	}
+	feasible := true
+	t := start + st[tour[0]]
+	for j := 1; j <= len(tour); j++ {
+		prev := tour[j-1]
+		act := tour[j%len(tour)]
+		t += d[prev][act]
+		if tw != nil {
+			if t < tw[act][0] && j < len(tour) {
+				t = tw[act][0]
+			}
+			if t > tw[act][1] {
+				feasible = false
+			}
+		}
+		if j < len(tour) {
+			t += st[act]
+		}
+	}
+	return t - start, feasible
+}
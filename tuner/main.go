@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"git.solver4all.com/azaryc2s/mtsp"
+	"io/ioutil"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* Automatic configuration of the solver over a set of instances (GRID or RANDOM), ranked by PAR10 or the shifted geometric mean of the times. */
+
+const (
+	searchGrid   = "GRID"
+	searchRandom = "RANDOM"
+	metricPAR10  = "PAR10"
+	metricSGM    = "SGM"
+	noneValue    = "none"
+	parPenalty   = 10
+)
+
+var cutSets mtsp.ArrayStringFlags
+var grbParams mtsp.ArrayStringFlags
+var instDir *string
+var solverBin *string
+var baseEnv *string
+var models *string
+var yBounds *string
+var lBoundStrats *string
+var extraArgs *string
+var search *string
+var samples *int
+var metric *string
+var shift *float64
+var timeLimit *int
+var trainFraction *float64
+var seed *int64
+
+//gurobiParam is a gurobi parameter with its value
+type gurobiParam struct {
+	name  string
+	value string
+}
+
+//config is one configuration of the solver
+type config struct {
+	model   string
+	cuts    string
+	yBounds string
+	lbstrat string
+	params  []gurobiParam
+}
+
+//result is the evaluation of a configuration on the training instances
+type result struct {
+	config config
+	solved int
+	par10  float64
+	sgm    float64
+}
+
+func main() {
+	flag.Var(&cutSets, "cutSets", "Cut set to be tried, the cuts separated by commas, or none. Can be repeated. Default none")
+	flag.Var(&grbParams, "grb", "Gurobi parameter with the values to be tried as Name=v1,v2, e.g. MIPFocus=0,1,2. Can be repeated")
+	instDir = flag.String("instances", "", "Directory with the instances")
+	solverBin = flag.String("solver", "../solver/solver", "Path to the solver binary")
+	baseEnv = flag.String("gurobiEnv", "../solver/gurobi.env", "Gurobi environment file with the base parameters of all runs. Its TimeLimit is replaced by -timeLimit")
+	models = flag.String("models", mtsp.MASTERMODEL_TSP, "Master models to be tried, separated by commas")
+	yBounds = flag.String("yBounds", mtsp.Y_BOUNDS_CONT, "Bounds of the Y-Variables to be tried, separated by commas")
+	lBoundStrats = flag.String("lbstrats", noneValue, "Lower bound strategies to be tried, separated by commas. A combination of strategies is joined by +, e.g. MST+FARTHEST")
+	extraArgs = flag.String("args", "", "Further arguments passed to every run of the solver, separated by spaces, e.g. -obj TOTAL")
+	search = flag.String("search", searchGrid, "Search over the configurations. GRID (default) evaluates all of them, RANDOM a random sample of -samples")
+	samples = flag.Int("samples", 10, "Number of configurations evaluated by the RANDOM search")
+	metric = flag.String("metric", metricPAR10, "Metric ranking the configurations. PAR10 (default) or SGM, the shifted geometric mean of the times")
+	shift = flag.Float64("shift", 10, "Shift of the geometric mean in seconds")
+	timeLimit = flag.Int("timeLimit", 600, "Time limit of each run in seconds")
+	trainFraction = flag.Float64("train", 1.0, "Fraction of the instances in the training subset")
+	seed = flag.Int64("seed", 1, "Seed of the training subset and the random search")
+
+	flag.Parse()
+	if *instDir == "" {
+		log.Printf("No instance directory passed!")
+		return
+	}
+	if len(cutSets) == 0 {
+		cutSets = mtsp.ArrayStringFlags{noneValue}
+	}
+	rnd := rand.New(rand.NewSource(*seed))
+	instances, err := trainingInstances(*instDir, *trainFraction, rnd)
+	if err != nil {
+		log.Printf("Couldn't open directory %s: %s\n", *instDir, err.Error())
+		return
+	}
+	if len(instances) == 0 {
+		log.Printf("No instances in %s\n", *instDir)
+		return
+	}
+	configs, err := configurations()
+	if err != nil {
+		log.Printf("%s\n", err.Error())
+		return
+	}
+	if *search == searchRandom && *samples < len(configs) {
+		perm := rnd.Perm(len(configs))
+		sampled := make([]config, *samples)
+		for c := 0; c < *samples; c++ {
+			sampled[c] = configs[perm[c]]
+		}
+		configs = sampled
+	}
+	solver, err := filepath.Abs(*solverBin)
+	if err != nil {
+		log.Printf("Couldn't find the solver %s: %s\n", *solverBin, err.Error())
+		return
+	}
+	baseParams, err := readGurobiEnv(*baseEnv)
+	if err != nil {
+		log.Printf("Couldn't read %s: %s\n", *baseEnv, err.Error())
+		return
+	}
+	log.Printf("Evaluating %d configurations on %d instances\n", len(configs), len(instances))
+
+	results := make([]result, 0, len(configs))
+	fmt.Printf("Config,Solved,PAR10,SGM\n")
+	for _, c := range configs {
+		res := result{config: c}
+		times := make([]float64, 0, len(instances))
+		for _, instFile := range instances {
+			runTime, solved, err := run(solver, baseParams, c, instFile)
+			if err != nil {
+				log.Printf("Run of %s on %s failed: %s\n", c.String(), instFile, err.Error())
+			}
+			if solved {
+				res.solved++
+				res.par10 += runTime
+			} else {
+				runTime = float64(*timeLimit)
+				res.par10 += parPenalty * runTime
+			}
+			times = append(times, runTime)
+		}
+		res.par10 /= float64(len(instances))
+		res.sgm = shiftedGeometricMean(times, *shift)
+		results = append(results, res)
+		fmt.Printf("%s,%d,%.2f,%.2f\n", c.String(), res.solved, res.par10, res.sgm)
+	}
+	sort.SliceStable(results, func(a, b int) bool {
+		if *metric == metricSGM {
+			return results[a].sgm < results[b].sgm
+		}
+		return results[a].par10 < results[b].par10
+	})
+	best := results[0]
+	log.Printf("Best configuration by %s: %s (solved %d/%d, PAR10 %.2f, SGM %.2f)\n", *metric, best.config.String(), best.solved, len(instances), best.par10, best.sgm)
+	log.Printf("Solver arguments: %s\n", strings.Join(best.config.args(), " "))
+	for _, p := range best.config.params {
+		log.Printf("Gurobi parameter: %s %s\n", p.name, p.value)
+	}
+}
+
+//trainingInstances returns the paths of a random subset of the instances in the directory with the given fraction of them
+func trainingInstances(dirName string, fraction float64, rnd *rand.Rand) ([]string, error) {
+	dir, err := ioutil.ReadDir(dirName)
+	if err != nil {
+		return nil, err
+	}
+	instances := make([]string, 0)
+	for _, f := range dir {
+		if strings.HasSuffix(f.Name(), ".json") {
+			path, err := filepath.Abs(filepath.Join(dirName, f.Name()))
+			if err != nil {
+				return nil, err
+			}
+			instances = append(instances, path)
+		}
+	}
+	rnd.Shuffle(len(instances), func(a, b int) { instances[a], instances[b] = instances[b], instances[a] })
+	count := int(math.Ceil(fraction * float64(len(instances))))
+	if count > len(instances) {
+		count = len(instances)
+	}
+	instances = instances[:count]
+	sort.Strings(instances)
+	return instances, nil
+}
+
+//configurations returns all combinations of the values of the flags
+func configurations() ([]config, error) {
+	params := make([][]gurobiParam, 1)
+	for _, p := range grbParams {
+		parts := strings.SplitN(p, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("the gurobi parameter %s is not of the form Name=v1,v2", p)
+		}
+		combined := make([][]gurobiParam, 0)
+		for _, prev := range params {
+			for _, v := range strings.Split(parts[1], ",") {
+				combined = append(combined, append(append([]gurobiParam{}, prev...), gurobiParam{parts[0], v}))
+			}
+		}
+		params = combined
+	}
+	configs := make([]config, 0)
+	for _, model := range strings.Split(*models, ",") {
+		for _, cuts := range cutSets {
+			for _, yb := range strings.Split(*yBounds, ",") {
+				for _, lb := range strings.Split(*lBoundStrats, ",") {
+					for _, p := range params {
+						configs = append(configs, config{model: model, cuts: cuts, yBounds: yb, lbstrat: lb, params: p})
+					}
+				}
+			}
+		}
+	}
+	return configs, nil
+}
+
+//String returns the configuration as one CSV field
+func (c config) String() string {
+	s := fmt.Sprintf("model=%s cuts=%s yBounds=%s lbstrat=%s", c.model, c.cuts, c.yBounds, c.lbstrat)
+	for _, p := range c.params {
+		s += fmt.Sprintf(" %s=%s", p.name, p.value)
+	}
+	return strings.Replace(s, ",", "+", -1)
+}
+
+//args returns the arguments of the solver for the configuration
+func (c config) args() []string {
+	args := []string{"-model", c.model, "-yBounds", c.yBounds}
+	if c.cuts != noneValue {
+		for _, cut := range strings.Split(c.cuts, ",") {
+			args = append(args, "-cuts", cut)
+		}
+	}
+	if c.lbstrat != noneValue {
+		args = append(args, "-lbstrat", strings.Replace(c.lbstrat, "+", ",", -1))
+	}
+	if *extraArgs != "" {
+		args = append(args, strings.Fields(*extraArgs)...)
+	}
+	return args
+}
+
+//readGurobiEnv returns the parameters of a gurobi environment file. A missing file has no parameters
+func readGurobiEnv(fileName string) ([]gurobiParam, error) {
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	params := make([]gurobiParam, 0)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		params = append(params, gurobiParam{fields[0], fields[1]})
+	}
+	return params, scanner.Err()
+}
+
+//run solves the instance with the configuration in a temporary directory. Returns the time in seconds and whether the instance was solved
+func run(solver string, baseParams []gurobiParam, c config, instFile string) (float64, bool, error) {
+	runDir, err := ioutil.TempDir("", "mtsp_tuner")
+	if err != nil {
+		return 0, false, err
+	}
+	defer os.RemoveAll(runDir)
+
+	//the parameters of the configuration replace the base parameters of the same name
+	params := append(append([]gurobiParam{}, c.params...), gurobiParam{"TimeLimit", fmt.Sprintf("%d", *timeLimit)})
+	envStr := ""
+	for _, p := range baseParams {
+		replaced := false
+		for _, q := range params {
+			replaced = replaced || strings.EqualFold(p.name, q.name)
+		}
+		if !replaced {
+			envStr += fmt.Sprintf("%s %s\n", p.name, p.value)
+		}
+	}
+	for _, p := range params {
+		envStr += fmt.Sprintf("%s %s\n", p.name, p.value)
+	}
+	err = ioutil.WriteFile(filepath.Join(runDir, "gurobi.env"), []byte(envStr), 0644)
+	if err != nil {
+		return 0, false, err
+	}
+
+	//the solver only checks the time limit inside gurobi, so runs hanging elsewhere are killed
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(2**timeLimit+60)*time.Second)
+	defer cancel()
+	outFile := filepath.Join(runDir, "solution.json")
+	args := append([]string{"-input", instFile, "-output", outFile, "-log", "1"}, c.args()...)
+	cmd := exec.CommandContext(ctx, solver, args...)
+	cmd.Dir = runDir
+	startTime := time.Now()
+	err = cmd.Run()
+	wallTime := time.Since(startTime).Seconds()
+	if err != nil {
+		return wallTime, false, err
+	}
+
+	instStr, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		return wallTime, false, err
+	}
+	inst := mtsp.MTSPInstance{}
+	err = json.Unmarshal(instStr, &inst)
+	if err != nil {
+		return wallTime, false, err
+	}
+	if inst.Solution == nil {
+		return wallTime, false, nil
+	}
+	solveTime, err := time.ParseDuration(inst.Solution.Time)
+	if err != nil {
+		solveTime = time.Duration(wallTime * float64(time.Second))
+	}
+	solved := (inst.Solution.Optimal || inst.Solution.Infeasible) && solveTime.Seconds() <= float64(*timeLimit)
+	return solveTime.Seconds(), solved, nil
+}
+
+//shiftedGeometricMean returns (prod_i (t_i + shift))^(1/n) - shift
+func shiftedGeometricMean(times []float64, shift float64) float64 {
+	if len(times) == 0 {
+		return 0
+	}
+	logSum := 0.0
+	for _, t := range times {
+		logSum += math.Log(t + shift)
+	}
+	return math.Exp(logSum/float64(len(times))) - shift
+}
@@ -7,11 +7,22 @@ const (
 	Y_BOUNDS_BIN     = "BIN"
 	MASTERMODEL_ATSP = "ATSP"
 	MASTERMODEL_TSP  = "TSP"
+	MASTERMODEL_SP   = "SP"
 	STRAT_BCH        = "BCH"
 	STRAT_LP         = "LP"
+	STRAT_LNS        = "LNS"
+	STRAT_CLUSTER    = "CLUSTER"
+	LNS_VEHICLES     = "VEHICLES"
+	LNS_REGION       = "REGION"
 	LBSTRAT_TSP      = "TSP"
+	LBSTRAT_FARTHEST = "FARTHEST"
+	LBSTRAT_MST      = "MST"
+	LBSTRAT_LP       = "LP"
+	LBSTRAT_ALL      = "ALL"
 	SUBTOURINEQ_TSP  = "TSP"
 	SUBTOURINEQ_MTZ  = "MTZ"
+	SUBTOURINEQ_SCF  = "SCF"
+	SUBTOURINEQ_GG   = "GG"
 	CUT_SEC          = "SEC"
 	CUT_BEND_V1      = "BEND_V1"
 	CUT_BEND_V2      = "BEND_V2"
@@ -19,6 +30,25 @@ const (
 	CUT_BEND_V4      = "BEND_V4"
 	CUT_BEND_V5      = "BEND_V5"
 	CUT_BEND_V6      = "BEND_V6"
+	CUT_NOGOOD       = "NOGOOD"
+	CUT_BEND_LP      = "BEND_LP"
+	CUT_NOGOOD_MIS   = "NOGOOD_MIS"
+	DEMAND_UNIT      = "UNIT"
+	DEMAND_UNIFORM   = "UNIFORM"
+	DEMAND_CLUSTERED = "CLUSTERED"
+	OBJ_MAKESPAN     = "MAKESPAN"
+	OBJ_TOTAL        = "TOTAL"
+	OBJ_WEIGHTED     = "WEIGHTED"
+	OBJ_LEX          = "LEX"
+	OBJ_PRIZE        = "PRIZE"
+	EDGES_ALL        = "ALL"
+	EDGES_KNN        = "KNN"
+	EDGES_DELAUNAY   = "DELAUNAY"
+	EDGES_TOURS      = "TOURS"
+	WEIGHT_EUC_2D    = "EUC_2D"
+	WEIGHT_CEIL_2D   = "CEIL_2D"
+	SEVERITY_ERROR   = "ERROR"
+	SEVERITY_WARNING = "WARNING"
 )
 
 type TSPInstance struct {
@@ -32,6 +62,8 @@ type TSPInstance struct {
 	EdgeWeightType  string      `json:"edge_weight_type"`
 	NodeCoordinates [][]float64 `json:"node_coordinates"`
 	EdgeWeights     [][]int     `json:"edge_weights"`
+	Prices          []int       `json:"prices,omitempty"`
+	TMax            int         `json:"tmax,omitempty"`
 }
 
 type MTSPInstance struct {
@@ -52,6 +84,34 @@ type MTSPInstance struct {
 	VehicleCount int   `json:"vehicle_count"`
 	TravelSpeeds []int `json:"travel_speeds"`
 
+	//ServiceTimes holds the time spent at each node, VehicleServiceTimes overrides it per vehicle if present
+	ServiceTimes        []int   `json:"service_times,omitempty"`
+	VehicleServiceTimes [][]int `json:"vehicle_service_times,omitempty"`
+
+	Demands    []int `json:"demands,omitempty"`
+	Capacities []int `json:"capacities,omitempty"`
+
+	//TimeWindows holds the [earliest, latest] start of service for each node, the one of the depot bounds the whole route
+	TimeWindows [][]int `json:"time_windows,omitempty"`
+
+	//AllowedVehicles lists the vehicles that may serve each node, an empty list allows all of them
+	AllowedVehicles [][]int `json:"allowed_vehicles,omitempty"`
+
+	//OpenRoutes means that the vehicles end at their last node and do not return to the depot
+	OpenRoutes bool `json:"open_routes,omitempty"`
+
+	//Prices collected by visiting the nodes and the maximum duration of each route for the team orienteering variant
+	Prices []int `json:"prices,omitempty"`
+	TMax   int   `json:"tmax,omitempty"`
+
+	//With OptionalVehicles some vehicles may stay at the depot. Using vehicle i costs FixedCosts[i] and at most MaxVehicles may be used, if given
+	OptionalVehicles bool  `json:"optional_vehicles,omitempty"`
+	FixedCosts       []int `json:"fixed_costs,omitempty"`
+	MaxVehicles      int   `json:"max_vehicles,omitempty"`
+
+	//MaxDurations[i] limits the length of the route of vehicle i (shift length), 0 means no limit
+	MaxDurations []int `json:"max_durations,omitempty"`
+
 	Solution *MTSPSolution
 }
 
@@ -60,15 +120,54 @@ type MTSPSolution struct {
 	LBound     int     `json:"lbound"`
 	UBound     int     `json:"ubound"`
 	Optimal    bool    `json:"optimal"`
+	Infeasible bool    `json:"infeasible,omitempty"`
 	RouteCosts []int   `json:"route_costs"`
 	Routes     [][]int `json:"routes"`
+	Objective  string  `json:"objective,omitempty"`
+	Makespan   int     `json:"makespan,omitempty"`
+	TotalCost  int     `json:"total_cost,omitempty"`
+	Prize      int     `json:"prize,omitempty"`
+	UsedVehicles int   `json:"used_vehicles,omitempty"`
+
+	//the assignment and edge variables fixed to zero by the bounds on the route lengths
+	FixedAssignments int `json:"fixed_assignments,omitempty"`
+	FixedEdges       int `json:"fixed_edges,omitempty"`
+
+	BalanceLevels []BalanceLevel `json:"balance_levels,omitempty"`
+	//Solutions holds the best distinct solutions of the pool, the best one first
+	Solutions []PoolSolution `json:"solutions,omitempty"`
+	//PortfolioWinner is the configuration of the portfolio, that proved optimality or found the best solution
+	PortfolioWinner string `json:"portfolio_winner,omitempty"`
 	TSPLength  int     `json:"tsp_length"`
+	//the lower bound on the makespan set before the solve and the strategy, that found it
+	CMaxLBound   int    `json:"cmax_lbound,omitempty"`
+	LBoundSource string `json:"lbound_source,omitempty"`
 
 	Time    string  `json:"time"`
 	System  SysInfo `json:"system"`
 	Comment string  `json:"comment"`
 }
 
+//BalanceLevel holds the length of the k-th longest route after balancing all routes up to level k
+type BalanceLevel struct {
+	Level   int    `json:"level"`
+	Value   int    `json:"value"`
+	Optimal bool   `json:"optimal"`
+	Time    string `json:"time"`
+}
+
+//MTSPObjective defines the objective of the master model as the weighted sum of Cmax and the total cost.
+//With Levels it is the sum of the len(Levels)+1 longest routes instead, while the sum of the t+1 longest routes is bounded by Levels[t].
+//With Prize the collected prices are maximized, visiting the nodes is optional and the routes may not take longer than the instance's TMax
+type MTSPObjective struct {
+	WCMax  int
+	WTotal int
+	Levels []int
+	Prize  bool
+	//PrizeWeights replace the prices of the nodes in the objective of the PRIZE model, if given
+	PrizeWeights []float64
+}
+
 // SysInfo saves the basic system information
 type SysInfo struct {
 	Platform string
@@ -83,6 +182,16 @@ type MTSPModel struct {
 	GMastermodel string
 	EdgeWeights  [][]int
 	TravelSpeeds []int
+	ServiceTimes [][]int
+	Demands      []int
+	Capacities   []int
+	TimeWindows  [][]int
+	Prices       []int
+	Allowed      [][]bool
+	OpenRoutes   bool
+	Optional     bool
+	FixedCosts   []int
+	MaxDurations []int
 	ps           [][]int
 	pp           []int
 	BestSol      MTSPSolution
@@ -91,9 +200,50 @@ type MTSPModel struct {
 	M            int
 	VarNames     []string
 	CMax         int
+	Edges        EdgeSet
+	FEdges       EdgeSet
 	XStart       int
 	YStart       int
 	XCount       int
 	YCount       int
+	CStart       int
+	CCount       int
+	FStart       int
+	FCount       int
+	LStart       int
+	LCount       int
+	RStart       int
+	RCount       int
+	BStart       int
+	BCount       int
+	Objective    MTSPObjective
+	CMaxUB       int
 	VarCount     int
+
+	//schedule returns the length of the route of vehicle i with the distances d and whether it meets the time windows
+	schedule    func(i int, route []int, d [][]int) (int, bool)
+	tripD       [][]int //shortest path distances, on which the trips are computed
+	tripX       []int
+	tripY       []int
+	fixedX      []bool
+	fixedY      []bool
+	FixedXCount int
+	FixedYCount int
+
+	//the number of cuts added by the callback to this model
+	CutsSECCount         int
+	CutsBendersCount     int
+	CutsFeasibilityCount int
+
+	//Fixing repeats the bound-based variable fixing in the callback, whenever a better solution is found
+	Fixing bool
+	//LocalSearch improves the heuristic solutions of the callback by moving nodes between the routes
+	LocalSearch bool
+	//Pool collects the best distinct solutions, if not nil
+	Pool *SolutionPool
+	//Shared is the incumbent shared with the other runs of a portfolio, Name the configuration of this run
+	Shared *SharedIncumbent
+	Name   string
+	//Quiet models only log errors, e.g. the subproblems of the pricing and the repairs of the LNS, that are solved very often
+	Quiet bool
 }
@@ -40,9 +40,9 @@ func CalcEdgeDist(coordinates [][]float64, distType string) [][]int {
 			xDist := coordinates[node][0] - coordinates[node2][0]
 			yDist := coordinates[node][1] - coordinates[node2][1]
 			var distance int
-			if distType == "EUC_2D" {
+			if distType == WEIGHT_EUC_2D {
 				distance = int(math.Sqrt(math.Pow(xDist, 2)+math.Pow(yDist, 2)) + 0.5)
-			} else if distType == "CEIL_2D" {
+			} else if distType == WEIGHT_CEIL_2D {
 				distance = int(math.Ceil(math.Sqrt(math.Pow(xDist, 2) + math.Pow(yDist, 2))))
 			}
 			result[node][node2] = distance
@@ -76,3 +76,284 @@ func SanitizeJsonArrayLineBreaks(json string) string {
 	}
 	return res
 }
+
+
+//ServiceTime returns the time vehicle i spends at node j
+func (inst *MTSPInstance) ServiceTime(i, j int) int {
+	if inst.VehicleServiceTimes != nil {
+		return inst.VehicleServiceTimes[i][j]
+	}
+	if inst.ServiceTimes != nil {
+		return inst.ServiceTimes[j]
+	}
+	return 0
+}
+
+//ServiceTimeMatrix returns the service times of all N nodes for each vehicle
+func (inst *MTSPInstance) ServiceTimeMatrix(N int) [][]int {
+	st := make([][]int, len(inst.TravelSpeeds))
+	for i := 0; i < len(st); i++ {
+		st[i] = make([]int, N)
+		for j := 0; j < N; j++ {
+			st[i][j] = inst.ServiceTime(i, j)
+		}
+	}
+	return st
+}
+
+//RouteCost returns the travel time of vehicle i along the route including the service times of the visited nodes
+func (inst *MTSPInstance) RouteCost(i int, route []int, d [][]int) int {
+	length, _ := inst.RouteSchedule(i, route, d)
+	return length
+}
+
+//RouteSchedule returns the travel time of vehicle i along the route, waiting for the time windows to open if needed,
+//and whether all time windows are met
+func (inst *MTSPInstance) RouteSchedule(i int, route []int, d [][]int) (int, bool) {
+	sd := make([][]int, len(route))
+	st := make([]int, len(route))
+	var tw [][]int
+	if inst.TimeWindows != nil {
+		tw = make([][]int, len(route))
+	}
+	for j := 0; j < len(route); j++ {
+		sd[j] = make([]int, len(route))
+		for k := 0; k < len(route); k++ {
+			if inst.OpenRoutes && route[k] == 0 {
+				continue
+			}
+			sd[j][k] = d[route[j]][route[k]] * inst.TravelSpeeds[i]
+		}
+		st[j] = inst.ServiceTime(i, route[j])
+		if tw != nil {
+			tw[j] = inst.TimeWindows[route[j]]
+		}
+	}
+	tour := make([]int, len(route))
+	for j := 0; j < len(tour); j++ {
+		tour[j] = j
+	}
+	return ScheduleLength(tour, sd, st, tw)
+}
+
+//RouteLoad returns the summed demand of the nodes on the route
+func (inst *MTSPInstance) RouteLoad(route []int) int {
+	load := 0
+	if inst.Demands == nil {
+		return load
+	}
+	for j := 0; j < len(route); j++ {
+		load += inst.Demands[route[j]]
+	}
+	return load
+}
+
+//IsCapacitated reports whether the instance restricts the load of the vehicles
+func (inst *MTSPInstance) IsCapacitated() bool {
+	return inst.Demands != nil && inst.Capacities != nil
+}
+
+//IsAllowed reports whether vehicle i may serve node j
+func (inst *MTSPInstance) IsAllowed(i, j int) bool {
+	if j == 0 || inst.AllowedVehicles == nil || len(inst.AllowedVehicles[j]) == 0 {
+		return true
+	}
+	for _, v := range inst.AllowedVehicles[j] {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
+
+//AllowedMatrix returns for each vehicle whether it may serve each of the N nodes, or nil if there are no restrictions
+func (inst *MTSPInstance) AllowedMatrix(N int) [][]bool {
+	if inst.AllowedVehicles == nil {
+		return nil
+	}
+	allowed := make([][]bool, len(inst.TravelSpeeds))
+	for i := 0; i < len(allowed); i++ {
+		allowed[i] = make([]bool, N)
+		for j := 0; j < N; j++ {
+			allowed[i][j] = inst.IsAllowed(i, j)
+		}
+	}
+	return allowed
+}
+
+//MaxDuration returns the duration limit of vehicle i, 0 if its route length is not limited
+func (inst *MTSPInstance) MaxDuration(i int) int {
+	if inst.MaxDurations == nil {
+		return 0
+	}
+	return inst.MaxDurations[i]
+}
+
+//UnservableNodes returns the nodes that no vehicle can serve, not even on a route visiting only this node.
+//If there are any, the instance has no feasible solution, unless nodes may be skipped
+func (inst *MTSPInstance) UnservableNodes(d [][]int) []int {
+	nodes := make([]int, 0)
+	for j := 1; j < len(d); j++ {
+		servable := false
+		for i := 0; i < len(inst.TravelSpeeds) && !servable; i++ {
+			if !inst.IsAllowed(i, j) {
+				continue
+			}
+			if inst.IsCapacitated() && inst.Demands[j] > inst.Capacities[i] {
+				continue
+			}
+			length, inTime := inst.RouteSchedule(i, []int{0, j}, d)
+			if !inTime || (inst.MaxDuration(i) > 0 && length > inst.MaxDuration(i)) {
+				continue
+			}
+			servable = true
+		}
+		if !servable {
+			nodes = append(nodes, j)
+		}
+	}
+	return nodes
+}
+
+//VehicleTypes groups the vehicles, that have the same speed, service times, capacity, duration limit and allowed nodes
+func (inst *MTSPInstance) VehicleTypes(N int) [][]int {
+	types := make([][]int, 0)
+	keys := make(map[string]int)
+	for i := 0; i < len(inst.TravelSpeeds); i++ {
+		capacity := 0
+		if inst.IsCapacitated() {
+			capacity = inst.Capacities[i]
+		}
+		st := make([]int, N)
+		allowed := make([]bool, N)
+		for j := 0; j < N; j++ {
+			st[j] = inst.ServiceTime(i, j)
+			allowed[j] = inst.IsAllowed(i, j)
+		}
+		key := fmt.Sprintf("%d|%d|%d|%v|%v", inst.TravelSpeeds[i], capacity, inst.MaxDuration(i), st, allowed)
+		t, ok := keys[key]
+		if !ok {
+			t = len(types)
+			keys[key] = t
+			types = append(types, []int{})
+		}
+		types[t] = append(types[t], i)
+	}
+	return types
+}
+
+//vehicleInstance returns a copy of the instance with vehicle i as its only vehicle
+func (inst *MTSPInstance) vehicleInstance(i int, N int) MTSPInstance {
+	sub := *inst
+	sub.Solution = nil
+	sub.VehicleCount = 1
+	sub.TravelSpeeds = []int{inst.TravelSpeeds[i]}
+	if inst.VehicleServiceTimes != nil {
+		sub.VehicleServiceTimes = [][]int{inst.VehicleServiceTimes[i]}
+	}
+	if inst.Capacities != nil {
+		sub.Capacities = []int{inst.Capacities[i]}
+	}
+	sub.AllowedVehicles = make([][]int, N)
+	for j := 1; j < len(sub.AllowedVehicles); j++ {
+		if !inst.IsAllowed(i, j) {
+			//no vehicle may serve the node
+			sub.AllowedVehicles[j] = []int{-1}
+		}
+	}
+	if inst.MaxDurations != nil {
+		sub.MaxDurations = []int{inst.MaxDurations[i]}
+	}
+	sub.FixedCosts = nil
+	sub.MaxVehicles = 0
+	return sub
+}
+
+//HasOptionalVehicles reports whether the vehicles may stay unused
+func (inst *MTSPInstance) HasOptionalVehicles() bool {
+	return inst.OptionalVehicles || inst.FixedCosts != nil || inst.MaxVehicles > 0
+}
+
+//UsedVehicles returns the number of non-empty routes
+func UsedVehicles(routes [][]int) int {
+	used := 0
+	for i := 0; i < len(routes); i++ {
+		if len(routes[i]) > 0 {
+			used++
+		}
+	}
+	return used
+}
+
+//SubInstance returns the instance restricted to the given nodes and vehicles, together with the restricted distances.
+//The nodes and vehicles are renumbered in the given order, so the depot has to be the first node
+func (inst *MTSPInstance) SubInstance(nodes []int, vehicles []int, d [][]int) (MTSPInstance, [][]int) {
+	sub := *inst
+	sub.Solution = nil
+	sub.NodeCount = len(nodes)
+	sub.VehicleCount = len(vehicles)
+	subD := make([][]int, len(nodes))
+	for a := 0; a < len(nodes); a++ {
+		subD[a] = make([]int, len(nodes))
+		for b := 0; b < len(nodes); b++ {
+			subD[a][b] = d[nodes[a]][nodes[b]]
+		}
+	}
+	sub.EdgeWeights = subD
+	if len(inst.NodeCoordinates) == len(d) {
+		sub.NodeCoordinates = make([][]float64, len(nodes))
+		for a := 0; a < len(nodes); a++ {
+			sub.NodeCoordinates[a] = inst.NodeCoordinates[nodes[a]]
+		}
+	}
+	sub.ServiceTimes = pickInts(inst.ServiceTimes, nodes)
+	sub.Demands = pickInts(inst.Demands, nodes)
+	sub.Prices = pickInts(inst.Prices, nodes)
+	if inst.TimeWindows != nil {
+		sub.TimeWindows = make([][]int, len(nodes))
+		for a := 0; a < len(nodes); a++ {
+			sub.TimeWindows[a] = inst.TimeWindows[nodes[a]]
+		}
+	}
+	sub.TravelSpeeds = pickInts(inst.TravelSpeeds, vehicles)
+	sub.Capacities = pickInts(inst.Capacities, vehicles)
+	sub.FixedCosts = pickInts(inst.FixedCosts, vehicles)
+	sub.MaxDurations = pickInts(inst.MaxDurations, vehicles)
+	if inst.VehicleServiceTimes != nil {
+		sub.VehicleServiceTimes = make([][]int, len(vehicles))
+		for v := 0; v < len(vehicles); v++ {
+			sub.VehicleServiceTimes[v] = pickInts(inst.VehicleServiceTimes[vehicles[v]], nodes)
+		}
+	}
+	if inst.AllowedVehicles != nil {
+		sub.AllowedVehicles = make([][]int, len(nodes))
+		for a := 1; a < len(nodes); a++ {
+			if len(inst.AllowedVehicles[nodes[a]]) == 0 {
+				continue
+			}
+			sub.AllowedVehicles[a] = []int{}
+			for v := 0; v < len(vehicles); v++ {
+				if inst.IsAllowed(vehicles[v], nodes[a]) {
+					sub.AllowedVehicles[a] = append(sub.AllowedVehicles[a], v)
+				}
+			}
+			if len(sub.AllowedVehicles[a]) == 0 {
+				//no vehicle may serve the node
+				sub.AllowedVehicles[a] = []int{-1}
+			}
+		}
+	}
+	return sub, subD
+}
+
+//pickInts returns the values at the given indices, or nil if there are no values
+func pickInts(values []int, indices []int) []int {
+	if values == nil {
+		return nil
+	}
+	res := make([]int, len(indices))
+	for a := 0; a < len(indices); a++ {
+		res[a] = values[indices[a]]
+	}
+	return res
+}
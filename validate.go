@@ -0,0 +1,196 @@
+package mtsp
+
+import "fmt"
+
+/* Validation of an instance before solving. Inconsistent fields are errors, duplicate coordinates and violations of the triangle inequality warnings. */
+
+//maxTriangleCheckNodes bounds the number of nodes, for which all triples are checked for the triangle inequality
+const maxTriangleCheckNodes = 500
+
+//eucRoundingTolerance is the largest violation of the triangle inequality caused by rounding each EUC_2D distance by at most 0.5
+const eucRoundingTolerance = 1
+
+//Diagnostic is a problem of an instance found by ValidateInstance
+type Diagnostic struct {
+	Severity string
+	Message  string
+}
+
+func (diag Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s", diag.Severity, diag.Message)
+}
+
+//HasErrors reports whether some of the diagnostics is an error
+func HasErrors(diags []Diagnostic) bool {
+	for _, diag := range diags {
+		if diag.Severity == SEVERITY_ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+type validator struct {
+	diags []Diagnostic
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.diags = append(v.diags, Diagnostic{SEVERITY_ERROR, fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(format string, args ...interface{}) {
+	v.diags = append(v.diags, Diagnostic{SEVERITY_WARNING, fmt.Sprintf(format, args...)})
+}
+
+//checkLength reports an error, if the optional array field does not have the expected length
+func (v *validator) checkLength(field string, length int, expected int, of string) {
+	if length > 0 && length != expected {
+		v.errorf("%s has %d entries, but there are %d %s", field, length, expected, of)
+	}
+}
+
+//ValidateInstance checks the instance for inconsistencies. Returns the errors, that prevent solving it, and the warnings
+func ValidateInstance(inst *MTSPInstance) []Diagnostic {
+	v := validator{}
+	N := len(inst.NodeCoordinates)
+	M := len(inst.TravelSpeeds)
+
+	if inst.NodeCount != N {
+		v.errorf("node_count is %d, but there are %d node_coordinates", inst.NodeCount, N)
+	}
+	if N < 2 {
+		v.errorf("The instance has %d nodes, but needs the depot and at least one node", N)
+	}
+	coordinatesValid := true
+	for j := 0; j < N; j++ {
+		if len(inst.NodeCoordinates[j]) < 2 {
+			v.errorf("node_coordinates[%d] has %d values instead of 2", j, len(inst.NodeCoordinates[j]))
+			coordinatesValid = false
+		}
+	}
+	if coordinatesValid {
+		v.checkDuplicates(inst.NodeCoordinates)
+	}
+	if inst.EdgeWeightType != WEIGHT_EUC_2D && inst.EdgeWeightType != WEIGHT_CEIL_2D {
+		v.errorf("Unknown edge_weight_type \"%s\", the distances would all be 0. Possible: {%s,%s}", inst.EdgeWeightType, WEIGHT_EUC_2D, WEIGHT_CEIL_2D)
+	}
+	if len(inst.EdgeWeights) > 0 {
+		if len(inst.EdgeWeights) != N {
+			v.errorf("edge_weights has %d rows, but there are %d nodes", len(inst.EdgeWeights), N)
+		}
+		for j := 0; j < len(inst.EdgeWeights); j++ {
+			if len(inst.EdgeWeights[j]) != len(inst.EdgeWeights) {
+				v.errorf("edge_weights is not square: row %d has %d entries instead of %d", j, len(inst.EdgeWeights[j]), len(inst.EdgeWeights))
+				break
+			}
+		}
+	}
+
+	if len(inst.Depots) == 0 {
+		v.warnf("No depots are given, node 0 is used as the depot")
+	}
+	for _, depot := range inst.Depots {
+		if depot < 0 || depot >= N {
+			v.errorf("The depot %d is not a node, the nodes are 0 to %d", depot, N-1)
+		} else if depot != 0 {
+			v.warnf("The depot %d is ignored, node 0 is used as the depot", depot)
+		}
+	}
+
+	if inst.VehicleCount != M {
+		v.errorf("vehicle_count is %d, but there are %d travel_speeds", inst.VehicleCount, M)
+	}
+	if M == 0 {
+		v.errorf("The instance has no vehicles")
+	}
+	for i, s := range inst.TravelSpeeds {
+		if s <= 0 {
+			v.errorf("travel_speeds[%d] is %d, but the speeds have to be positive", i, s)
+		}
+	}
+
+	v.checkLength("service_times", len(inst.ServiceTimes), N, "nodes")
+	v.checkLength("vehicle_service_times", len(inst.VehicleServiceTimes), M, "vehicles")
+	for i := 0; i < len(inst.VehicleServiceTimes); i++ {
+		v.checkLength(fmt.Sprintf("vehicle_service_times[%d]", i), len(inst.VehicleServiceTimes[i]), N, "nodes")
+	}
+	v.checkLength("demands", len(inst.Demands), N, "nodes")
+	v.checkLength("capacities", len(inst.Capacities), M, "vehicles")
+	if (len(inst.Demands) > 0) != (len(inst.Capacities) > 0) {
+		v.errorf("demands and capacities have to be given together")
+	}
+	v.checkLength("time_windows", len(inst.TimeWindows), N, "nodes")
+	for j := 0; j < len(inst.TimeWindows); j++ {
+		if len(inst.TimeWindows[j]) != 2 {
+			v.errorf("time_windows[%d] has %d values instead of 2", j, len(inst.TimeWindows[j]))
+		} else if inst.TimeWindows[j][0] > inst.TimeWindows[j][1] {
+			v.errorf("time_windows[%d] is empty: [%d,%d]", j, inst.TimeWindows[j][0], inst.TimeWindows[j][1])
+		}
+	}
+	v.checkLength("allowed_vehicles", len(inst.AllowedVehicles), N, "nodes")
+	for j := 0; j < len(inst.AllowedVehicles); j++ {
+		for _, i := range inst.AllowedVehicles[j] {
+			if i < 0 || i >= M {
+				v.errorf("allowed_vehicles[%d] contains the vehicle %d, the vehicles are 0 to %d", j, i, M-1)
+			}
+		}
+	}
+	v.checkLength("prices", len(inst.Prices), N, "nodes")
+	v.checkLength("fixed_costs", len(inst.FixedCosts), M, "vehicles")
+	v.checkLength("max_durations", len(inst.MaxDurations), M, "vehicles")
+	if inst.MaxVehicles < 0 || inst.MaxVehicles > M {
+		v.warnf("max_vehicles is %d, but there are %d vehicles", inst.MaxVehicles, M)
+	}
+
+	if HasErrors(v.diags) {
+		//the distances can not be computed
+		return v.diags
+	}
+	tolerance := 0
+	if inst.EdgeWeightType == WEIGHT_EUC_2D {
+		tolerance = eucRoundingTolerance
+	}
+	v.checkTriangleInequality(CalcEdgeDist(inst.NodeCoordinates, inst.EdgeWeightType), tolerance)
+	return v.diags
+}
+
+//checkDuplicates warns about the nodes with the same coordinates as an earlier node, their distance is 0
+func (v *validator) checkDuplicates(coordinates [][]float64) {
+	seen := make(map[[2]float64]int)
+	for j := 0; j < len(coordinates); j++ {
+		key := [2]float64{coordinates[j][0], coordinates[j][1]}
+		if k, ok := seen[key]; ok {
+			v.warnf("Node %d has the same coordinates (%v,%v) as node %d", j, key[0], key[1], k)
+			continue
+		}
+		seen[key] = j
+	}
+}
+
+//checkTriangleInequality warns about the number of triples with d[a][c] > d[a][b] + d[b][c] + tolerance and the largest violation
+func (v *validator) checkTriangleInequality(d [][]int, tolerance int) {
+	N := len(d)
+	if N > maxTriangleCheckNodes {
+		v.warnf("The triangle inequality was not checked, since the instance has more than %d nodes", maxTriangleCheckNodes)
+		return
+	}
+	violations, worst, wa, wb, wc := 0, 0, 0, 0, 0
+	for a := 0; a < N; a++ {
+		for b := 0; b < N; b++ {
+			for c := 0; c < N; c++ {
+				if a == b || b == c || a == c {
+					continue
+				}
+				if excess := d[a][c] - d[a][b] - d[b][c]; excess > tolerance {
+					violations++
+					if excess > worst {
+						worst, wa, wb, wc = excess, a, b, c
+					}
+				}
+			}
+		}
+	}
+	if violations > 0 {
+		v.warnf("%d triples violate the triangle inequality, the largest by %d: d[%d][%d]=%d > d[%d][%d]+d[%d][%d]=%d", violations, worst, wa, wc, d[wa][wc], wa, wb, wb, wc, d[wa][wb]+d[wb][wc])
+	}
+}
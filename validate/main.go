@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"git.solver4all.com/azaryc2s/mtsp"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//checks the instances given as files or directories and prints their errors and warnings.
+//Exits with 1, if some instance has errors or can not be read
+func main() {
+	if len(os.Args) < 2 {
+		log.Printf("No arguments passed!")
+		os.Exit(1)
+	}
+	failed := false
+	for _, arg := range os.Args[1:] {
+		fileNames := []string{arg}
+		info, err := os.Stat(arg)
+		if err != nil {
+			log.Printf("Couldn't open %s: %s\n", arg, err.Error())
+			failed = true
+			continue
+		}
+		if info.IsDir() {
+			dir, err := ioutil.ReadDir(arg)
+			if err != nil {
+				log.Printf("Couldn't open directory %s: %s\n", arg, err.Error())
+				failed = true
+				continue
+			}
+			fileNames = fileNames[:0]
+			for _, f := range dir {
+				if strings.HasSuffix(f.Name(), ".json") {
+					fileNames = append(fileNames, filepath.Join(arg, f.Name()))
+				}
+			}
+		}
+		for _, fileName := range fileNames {
+			if !validate(fileName) {
+				failed = true
+			}
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+//validate prints the diagnostics of the instance. Returns false, if it has errors
+func validate(fileName string) bool {
+	instStr, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		fmt.Printf("%s: %s: %s\n", fileName, mtsp.SEVERITY_ERROR, err.Error())
+		return false
+	}
+	inst := mtsp.MTSPInstance{}
+	err = json.Unmarshal(instStr, &inst)
+	if err != nil {
+		fmt.Printf("%s: %s: %s\n", fileName, mtsp.SEVERITY_ERROR, err.Error())
+		return false
+	}
+	diags := mtsp.ValidateInstance(&inst)
+	for _, diag := range diags {
+		fmt.Printf("%s: %s\n", fileName, diag.String())
+	}
+	if len(diags) == 0 {
+		fmt.Printf("%s: OK\n", fileName)
+	}
+	return !mtsp.HasErrors(diags)
+}